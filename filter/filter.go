@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+// Rules decide which accounts are left out of the analysis. Pull requests
+// authored by an excluded account are dropped along with their reviews, and
+// reviews by and review requests of an excluded account are dropped from the
+// remaining pull requests.
+type Rules struct {
+	// Bots excludes accounts whose type is "Bot".
+	Bots bool `json:"bots"`
+	// Patterns are case insensitive login globs where * matches any run of
+	// characters and ? a single one, e.g. "*[bot]" or "renovate*".
+	Patterns []string `json:"patterns"`
+	// Deny lists logins to exclude, case insensitively.
+	Deny []string `json:"deny"`
+}
+
+// Excluded counts what the rules removed.
+type Excluded struct {
+	PullRequests int      `json:"pullRequests"`
+	Reviews      int      `json:"reviews"`
+	Logins       []string `json:"logins"`
+}
+
+// DefaultRules only exclude bot accounts.
+func DefaultRules() *Rules {
+	return &Rules{Bots: true}
+}
+
+// LoadRules reads rules from a JSON file.
+func LoadRules(filename string) (*Rules, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// globToRegexp only gives * and ? a special meaning, so brackets in patterns
+// like "*[bot]" match literally.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(strings.ToLower(pattern))
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.Compile("^" + quoted + "$")
+}
+
+type matcher struct {
+	rules    *Rules
+	patterns []*regexp.Regexp
+	deny     map[string]bool
+}
+
+func newMatcher(rules *Rules) (*matcher, error) {
+	m := &matcher{rules: rules, deny: map[string]bool{}}
+	for _, pattern := range rules.Patterns {
+		re, err := globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	for _, login := range rules.Deny {
+		m.deny[strings.ToLower(login)] = true
+	}
+	return m, nil
+}
+
+func (m *matcher) excludes(user *forge.User) bool {
+	if m.rules.Bots && user.GetType() == "Bot" {
+		return true
+	}
+
+	login := strings.ToLower(user.GetLogin())
+	if m.deny[login] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(login) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the pull requests left after applying the rules, without
+// modifying the given ones, and what was excluded.
+func Apply(pullDetails []*forge.PullDetails, rules *Rules) ([]*forge.PullDetails, *Excluded, error) {
+	m, err := newMatcher(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excluded := &Excluded{Logins: []string{}}
+	excludedLogins := map[string]bool{}
+	filteredPullDetails := []*forge.PullDetails{}
+
+	for _, pullDetail := range pullDetails {
+		author := pullDetail.PullRequest.GetUser()
+		if m.excludes(author) {
+			excludedLogins[author.GetLogin()] = true
+			excluded.PullRequests++
+			continue
+		}
+
+		reviews := []*forge.PullRequestReview{}
+		for _, review := range pullDetail.Reviews {
+			if m.excludes(review.GetUser()) {
+				excludedLogins[review.GetUser().GetLogin()] = true
+				excluded.Reviews++
+				continue
+			}
+			reviews = append(reviews, review)
+		}
+
+		// Review requests only carry a requested reviewer on the
+		// review_requested and review_request_removed events.
+		events := []*forge.IssueEvent{}
+		for _, event := range pullDetail.Events {
+			if reviewer := event.GetRequestedReviewer(); reviewer != nil && m.excludes(reviewer) {
+				excludedLogins[reviewer.GetLogin()] = true
+				continue
+			}
+			events = append(events, event)
+		}
+
+		requestedReviewers := []*forge.User{}
+		for _, reviewer := range pullDetail.PullRequest.RequestedReviewers {
+			if m.excludes(reviewer) {
+				excludedLogins[reviewer.GetLogin()] = true
+				continue
+			}
+			requestedReviewers = append(requestedReviewers, reviewer)
+		}
+
+		if len(reviews) != len(pullDetail.Reviews) || len(events) != len(pullDetail.Events) || len(requestedReviewers) != len(pullDetail.PullRequest.RequestedReviewers) {
+			filteredPullDetail := *pullDetail
+			filteredPullDetail.Reviews = reviews
+			// Events stay nil when they weren't downloaded.
+			if len(events) != len(pullDetail.Events) {
+				filteredPullDetail.Events = events
+			}
+			if len(requestedReviewers) != len(pullDetail.PullRequest.RequestedReviewers) {
+				pull := *pullDetail.PullRequest
+				pull.RequestedReviewers = requestedReviewers
+				filteredPullDetail.PullRequest = &pull
+			}
+			pullDetail = &filteredPullDetail
+		}
+		filteredPullDetails = append(filteredPullDetails, pullDetail)
+	}
+
+	for login := range excludedLogins {
+		excluded.Logins = append(excluded.Logins, login)
+	}
+	sort.Strings(excluded.Logins)
+
+	return filteredPullDetails, excluded, nil
+}
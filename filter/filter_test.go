@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"testing"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUser(login, userType string) *forge.User {
+	return &forge.User{Login: gogithub.String(login), Type: gogithub.String(userType)}
+}
+
+func Test_Apply(t *testing.T) {
+	pullDetails := []*forge.PullDetails{
+		{
+			PullRequest: &forge.PullRequest{User: newUser("dependabot[bot]", "Bot")},
+			Reviews:     []*forge.PullRequestReview{{User: newUser("alice", "User")}},
+		},
+		{
+			PullRequest: &forge.PullRequest{User: newUser("alice", "User")},
+			Reviews: []*forge.PullRequestReview{
+				{User: newUser("bob", "User")},
+				{User: newUser("Renovate-Helper", "User")},
+				{User: newUser("ci-robot", "User")},
+			},
+		},
+		{
+			PullRequest: &forge.PullRequest{User: newUser("abot", "User")},
+		},
+	}
+
+	rules := &Rules{Bots: true, Patterns: []string{"*[bot]", "renovate*"}, Deny: []string{"CI-Robot"}}
+	filteredPullDetails, excluded, err := Apply(pullDetails, rules)
+	assert.Nil(t, err)
+
+	assert.Len(t, filteredPullDetails, 2)
+	assert.Len(t, filteredPullDetails[0].Reviews, 1)
+	assert.Len(t, pullDetails[1].Reviews, 3, "the given pull requests must not be modified")
+	assert.Equal(t, &Excluded{
+		PullRequests: 1,
+		Reviews:      2,
+		Logins:       []string{"Renovate-Helper", "ci-robot", "dependabot[bot]"},
+	}, excluded)
+}
+
+func Test_ApplyToReviewRequests(t *testing.T) {
+	assert := assert.New(t)
+	requested := func(reviewer *forge.User) *forge.IssueEvent {
+		return &forge.IssueEvent{Event: gogithub.String("review_requested"), RequestedReviewer: reviewer}
+	}
+	pullDetails := []*forge.PullDetails{
+		{
+			PullRequest: &forge.PullRequest{
+				User:               newUser("alice", "User"),
+				RequestedReviewers: []*forge.User{newUser("renovate-helper", "User"), newUser("carol", "User")},
+			},
+			Events: []*forge.IssueEvent{
+				requested(newUser("ci-robot", "User")),
+				requested(newUser("bob", "User")),
+				{Event: gogithub.String("merged")},
+			},
+		},
+		{
+			PullRequest: &forge.PullRequest{User: newUser("bob", "User")},
+			Reviews:     []*forge.PullRequestReview{{User: newUser("ci-robot", "User")}},
+		},
+	}
+
+	rules := &Rules{Patterns: []string{"renovate*"}, Deny: []string{"ci-robot"}}
+	filteredPullDetails, excluded, err := Apply(pullDetails, rules)
+	assert.Nil(err)
+
+	assert.Len(filteredPullDetails[0].Events, 2)
+	assert.Equal("bob", filteredPullDetails[0].Events[0].GetRequestedReviewer().GetLogin())
+	assert.Len(filteredPullDetails[0].PullRequest.RequestedReviewers, 1)
+	assert.Equal("carol", filteredPullDetails[0].PullRequest.RequestedReviewers[0].GetLogin())
+	assert.Nil(filteredPullDetails[1].Events, "events that weren't downloaded must stay nil")
+
+	assert.Len(pullDetails[0].Events, 3, "the given pull requests must not be modified")
+	assert.Len(pullDetails[0].PullRequest.RequestedReviewers, 2, "the given pull requests must not be modified")
+	assert.Equal([]string{"ci-robot", "renovate-helper"}, excluded.Logins)
+	assert.Equal(1, excluded.Reviews)
+}
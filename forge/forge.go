@@ -0,0 +1,121 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+)
+
+const (
+	METADATA_KEY = "metadata"
+)
+
+// ErrNotFound is matched, with errors.Is, by provider errors for change
+// requests that no longer exist, such as deleted pull requests.
+var ErrNotFound = errors.New("change request not found")
+
+// Change requests from every provider are normalized into GitHub's pull
+// request schema, which is what ends up in the store and what the graph reads.
+type PullRequest = github.PullRequest
+
+type PullRequestReview = github.PullRequestReview
+
+type CommitFile = github.CommitFile
+
+type User = github.User
+
+type PullRequestComment = github.PullRequestComment
+
+type IssueComment = github.IssueComment
+
+type RepositoryCommit = github.RepositoryCommit
+
+type IssueEvent = github.IssueEvent
+
+type PullDetails struct {
+	// Repo is the "owner/repo" the pull request was imported from.
+	Repo        string
+	PullRequest *PullRequest
+	Reviews     []*PullRequestReview
+	Files       []*CommitFile
+	// ReviewComments are the inline comments on the diff and Comments the
+	// conversation comments. Both are empty for pull requests downloaded
+	// before comments were, or from providers that don't have them.
+	ReviewComments []*PullRequestComment
+	Comments       []*IssueComment
+	// Commits are empty for pull requests downloaded before commits were, or
+	// from providers that don't have them.
+	Commits []*RepositoryCommit
+	// Events is nil, rather than empty, for pull requests whose events weren't
+	// downloaded, so missing data can be told apart from no review requests.
+	Events []*IssueEvent
+}
+
+// LinesChanged is the number of lines added and deleted by the pull request.
+// The pull request list API doesn't include additions and deletions, so the
+// downloaded files are preferred when present.
+func (p *PullDetails) LinesChanged() int {
+	if len(p.Files) == 0 {
+		return p.PullRequest.GetAdditions() + p.PullRequest.GetDeletions()
+	}
+
+	linesChanged := 0
+	for _, file := range p.Files {
+		linesChanged += file.GetAdditions() + file.GetDeletions()
+	}
+	return linesChanged
+}
+
+// FilesChanged is the number of files touched by the pull request, preferring
+// the downloaded files like LinesChanged.
+func (p *PullDetails) FilesChanged() int {
+	if len(p.Files) == 0 {
+		return p.PullRequest.GetChangedFiles()
+	}
+	return len(p.Files)
+}
+
+// Metadata let's us store additional information about the data we're storing
+// Such as when we might need or want to redownload data
+type Metadata struct {
+	LastModifiedTime time.Time `json:"lastModifiedTime"`
+	LastPullNumber   int       `json:"lastPullNumber"`
+	// LastUpdatedAt is the most recent updated_at of any pull request seen by
+	// a completed sync. Pull requests updated after it are (re)downloaded.
+	LastUpdatedAt time.Time `json:"lastUpdatedAt"`
+}
+
+// Provider is a code forge that change requests can be downloaded from.
+type Provider interface {
+	// ListMergedChangeRequests calls fn for every merged change request updated
+	// after since, from the most recently updated to the least recently
+	// updated. Returning an error from fn stops the listing.
+	ListMergedChangeRequests(ctx context.Context, since time.Time, fn func(*PullRequest) error) error
+	// ListReviews returns the reviews and approvals of a change request.
+	ListReviews(ctx context.Context, number int) ([]*PullRequestReview, error)
+	// ListFiles returns the files changed by a change request.
+	ListFiles(ctx context.Context, number int) ([]*CommitFile, error)
+}
+
+// CommentProvider is implemented by providers that can also download the
+// comments of a change request.
+type CommentProvider interface {
+	// ListReviewComments returns the inline comments on the diff.
+	ListReviewComments(ctx context.Context, number int) ([]*PullRequestComment, error)
+	// ListComments returns the conversation comments.
+	ListComments(ctx context.Context, number int) ([]*IssueComment, error)
+}
+
+// CommitProvider is implemented by providers that can also download the
+// commits of a change request.
+type CommitProvider interface {
+	ListCommits(ctx context.Context, number int) ([]*RepositoryCommit, error)
+}
+
+// EventProvider is implemented by providers that can also download the
+// events of a change request, such as review requests.
+type EventProvider interface {
+	ListEvents(ctx context.Context, number int) ([]*IssueEvent, error)
+}
@@ -0,0 +1,283 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/store"
+)
+
+const (
+	DEFAULT_WORKERS = 4
+)
+
+func readOrCreateMetadata(cache store.Store) (*Metadata, error) {
+	metadata := &Metadata{
+		// Never modified
+		LastModifiedTime: time.Unix(0, 0).UTC(),
+		LastPullNumber:   -1,
+		LastUpdatedAt:    time.Unix(0, 0).UTC(),
+	}
+	metadataContents, err := cache.Get(METADATA_KEY)
+	if err != nil {
+		if err == store.ErrNotFound {
+			metadataBytes, err := json.Marshal(metadata)
+			if err != nil {
+				log.Printf("Error marshalling metadata: %v", err)
+				return nil, errors.New("error marshalling metadata")
+			}
+			if err := cache.Put(METADATA_KEY, metadataBytes); err != nil {
+				log.Printf("Error saving metadata: %v", err)
+				return nil, errors.New("error saving metadata")
+			}
+		} else {
+			log.Printf("Error getting metadata: %v", err)
+		}
+	} else {
+		if err := json.Unmarshal(metadataContents, metadata); err != nil {
+			log.Printf("Error unmarshalling metadata: %v", err)
+			return nil, errors.New("error unmarshalling metadata")
+		}
+	}
+	return metadata, nil
+}
+
+func updateMetadata(cache store.Store, metadata *Metadata) error {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Error marshalling metadata: %v", err)
+		return errors.New("error marshalling metadata")
+	}
+	if err := cache.Put(METADATA_KEY, metadataBytes); err != nil {
+		log.Printf("Error saving metadata: %v", err)
+		return errors.New("error saving metadata")
+	}
+	return nil
+}
+
+// isCached reports whether the pull request is already in the store with the
+// same updated_at, in which case its reviews and files don't need to be
+// refetched.
+func isCached(cache store.Store, pr *PullRequest) bool {
+	prBytes, err := cache.Get(fmt.Sprintf("%d", pr.GetNumber()))
+	if err != nil {
+		return false
+	}
+
+	var cached *PullRequest
+	if err := json.Unmarshal(prBytes, &cached); err != nil {
+		return false
+	}
+	return cached.GetUpdatedAt().Equal(pr.GetUpdatedAt())
+}
+
+func putJSON(cache store.Store, key string, value interface{}) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Error marshalling %s: %v", key, err)
+		return fmt.Errorf("error marshalling %s", key)
+	}
+	return cache.Put(key, valueBytes)
+}
+
+// lockedStore serializes access to a store, since stores aren't required to
+// be safe for concurrent use.
+type lockedStore struct {
+	mu    sync.Mutex
+	store store.Store
+}
+
+func (l *lockedStore) Get(key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store.Get(key)
+}
+
+func (l *lockedStore) Put(key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store.Put(key, value)
+}
+
+// downloadPullDetails downloads the reviews, files and whatever else the
+// provider supports of a single change request into the store.
+func downloadPullDetails(ctx context.Context, provider Provider, cache store.Store, pr *PullRequest) error {
+	reviews, err := provider.ListReviews(ctx, pr.GetNumber())
+	if err != nil {
+		log.Printf("Error downloading reviews: %v", err)
+		return fmt.Errorf("error downloading reviews: %w", err)
+	}
+	if err := putJSON(cache, fmt.Sprintf("%d/reviews", pr.GetNumber()), reviews); err != nil {
+		return err
+	}
+
+	files, err := provider.ListFiles(ctx, pr.GetNumber())
+	if err != nil {
+		log.Printf("Error downloading files: %v", err)
+		return fmt.Errorf("error downloading files: %w", err)
+	}
+	if err := putJSON(cache, fmt.Sprintf("%d/files", pr.GetNumber()), files); err != nil {
+		return err
+	}
+
+	if commentProvider, ok := provider.(CommentProvider); ok {
+		reviewComments, err := commentProvider.ListReviewComments(ctx, pr.GetNumber())
+		if err != nil {
+			log.Printf("Error downloading review comments: %v", err)
+			return fmt.Errorf("error downloading review comments: %w", err)
+		}
+		if err := putJSON(cache, fmt.Sprintf("%d/review_comments", pr.GetNumber()), reviewComments); err != nil {
+			return err
+		}
+
+		comments, err := commentProvider.ListComments(ctx, pr.GetNumber())
+		if err != nil {
+			log.Printf("Error downloading comments: %v", err)
+			return fmt.Errorf("error downloading comments: %w", err)
+		}
+		if err := putJSON(cache, fmt.Sprintf("%d/comments", pr.GetNumber()), comments); err != nil {
+			return err
+		}
+	}
+
+	if commitProvider, ok := provider.(CommitProvider); ok {
+		commits, err := commitProvider.ListCommits(ctx, pr.GetNumber())
+		if err != nil {
+			log.Printf("Error downloading commits: %v", err)
+			return fmt.Errorf("error downloading commits: %w", err)
+		}
+		if err := putJSON(cache, fmt.Sprintf("%d/commits", pr.GetNumber()), commits); err != nil {
+			return err
+		}
+	}
+
+	if eventProvider, ok := provider.(EventProvider); ok {
+		events, err := eventProvider.ListEvents(ctx, pr.GetNumber())
+		if err != nil {
+			log.Printf("Error downloading events: %v", err)
+			return fmt.Errorf("error downloading events: %w", err)
+		}
+		if err := putJSON(cache, fmt.Sprintf("%d/events", pr.GetNumber()), events); err != nil {
+			return err
+		}
+	}
+
+	// The pull request is written last so that isCached only skips it
+	// once everything else is in the store.
+	if err := putJSON(cache, fmt.Sprintf("%d", pr.GetNumber()), pr); err != nil {
+		return err
+	}
+
+	log.Printf("Downloaded %d", pr.GetNumber())
+	return nil
+}
+
+// Sync (re)downloads every merged change request touched since
+// Metadata.LastUpdatedAt into the store, along with its reviews and files, the
+// comments of a CommentProvider, the commits of a CommitProvider and the
+// events of an EventProvider. The details of up to workers change requests
+// are downloaded at once, so providers must be safe for concurrent use. Change
+// requests deleted since they were listed are skipped. The high-water mark is
+// only advanced once every download completes so an interrupted sync is
+// resumed on the next run.
+func Sync(ctx context.Context, provider Provider, cache store.Store, workers int) error {
+	metadata, err := readOrCreateMetadata(cache)
+	if err != nil {
+		return err
+	}
+
+	// check metadata to see if we need to update
+
+	WAIT_TIME := -time.Second * 20
+	if metadata.LastModifiedTime.After(time.Now().Add(WAIT_TIME)) {
+		log.Printf("LastModifiedTime is %v, not updating", metadata.LastModifiedTime)
+		duration := -time.Now().Add(WAIT_TIME).Sub(metadata.LastModifiedTime)
+		log.Printf("Will update in %v", duration)
+		return nil
+	}
+
+	log.Printf("Metadata: %#v", metadata)
+
+	if workers < 1 {
+		workers = 1
+	}
+	cache = &lockedStore{store: cache}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var downloaded int64
+	pullRequests := make(chan *PullRequest)
+	// Each worker stops at its first error, so the buffer never fills up.
+	workerErrs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pr := range pullRequests {
+				if err := downloadPullDetails(ctx, provider, cache, pr); err != nil {
+					if errors.Is(err, ErrNotFound) {
+						log.Printf("Skipping %d: %v", pr.GetNumber(), err)
+						continue
+					}
+					workerErrs <- err
+					cancel()
+					return
+				}
+				atomic.AddInt64(&downloaded, 1)
+			}
+		}()
+	}
+
+	lastUpdatedAt := metadata.LastUpdatedAt
+	lastPullNumber := metadata.LastPullNumber
+
+	err = provider.ListMergedChangeRequests(ctx, metadata.LastUpdatedAt, func(pr *PullRequest) error {
+		if pr.GetUpdatedAt().After(lastUpdatedAt) {
+			lastUpdatedAt = pr.GetUpdatedAt()
+		}
+		if pr.GetNumber() > lastPullNumber {
+			lastPullNumber = pr.GetNumber()
+		}
+
+		if isCached(cache, pr) {
+			return nil
+		}
+
+		select {
+		case pullRequests <- pr:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(pullRequests)
+	wg.Wait()
+	close(workerErrs)
+
+	// A failed download cancels the listing, so its error is the one worth
+	// returning.
+	if workerErr := <-workerErrs; workerErr != nil {
+		return workerErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := updateMetadata(cache, &Metadata{
+		LastModifiedTime: time.Now().UTC(),
+		LastPullNumber:   lastPullNumber,
+		LastUpdatedAt:    lastUpdatedAt,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Downloaded %d pull requests", downloaded)
+	return nil
+}
@@ -0,0 +1,197 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStore map[string][]byte
+
+func (m memoryStore) Get(key string) ([]byte, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return value, nil
+}
+
+func (m memoryStore) Put(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+type fakeProvider struct {
+	pullRequests []*PullRequest
+	reviewCalls  int32
+	// failFiles makes ListFiles fail for the change request with this number.
+	failFiles int
+	// deleted makes ListReviews report the change request with this number as
+	// not found.
+	deleted int
+}
+
+func (f *fakeProvider) ListMergedChangeRequests(ctx context.Context, since time.Time, fn func(*PullRequest) error) error {
+	for _, pr := range f.pullRequests {
+		if !pr.GetUpdatedAt().After(since) {
+			return nil
+		}
+		if err := fn(pr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeProvider) ListReviews(ctx context.Context, number int) ([]*PullRequestReview, error) {
+	atomic.AddInt32(&f.reviewCalls, 1)
+	if number == f.deleted {
+		return nil, fmt.Errorf("listing reviews of %d: %w", number, ErrNotFound)
+	}
+	return []*PullRequestReview{{State: github.String("APPROVED")}}, nil
+}
+
+func (f *fakeProvider) ListFiles(ctx context.Context, number int) ([]*CommitFile, error) {
+	if number == f.failFiles {
+		return nil, errors.New("boom")
+	}
+	return []*CommitFile{}, nil
+}
+
+func newPullRequest(number int, updatedAt time.Time) *PullRequest {
+	return &PullRequest{
+		Number:    github.Int(number),
+		UpdatedAt: &updatedAt,
+		MergedAt:  &updatedAt,
+	}
+}
+
+func Test_SyncWritesRecordsAndMetadata(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+	cache := memoryStore{}
+	provider := &fakeProvider{pullRequests: []*PullRequest{
+		newPullRequest(1, now.Add(-time.Hour)),
+		newPullRequest(2, now.Add(-2*time.Hour)),
+	}}
+
+	assert.Nil(Sync(context.Background(), provider, cache, 1))
+	assert.Contains(cache, "1")
+	assert.Contains(cache, "1/reviews")
+	assert.Contains(cache, "2/files")
+	assert.Equal(int32(2), provider.reviewCalls)
+
+	var metadata Metadata
+	assert.Nil(json.Unmarshal(cache[METADATA_KEY], &metadata))
+	assert.True(metadata.LastUpdatedAt.Equal(now.Add(-time.Hour)))
+	assert.Equal(2, metadata.LastPullNumber)
+}
+
+func Test_SyncRefetchesOnlyUpdatedPullRequests(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+	cache := memoryStore{}
+	provider := &fakeProvider{pullRequests: []*PullRequest{
+		newPullRequest(1, now.Add(-time.Hour)),
+		newPullRequest(2, now.Add(-2*time.Hour)),
+	}}
+	assert.Nil(Sync(context.Background(), provider, cache, 1))
+
+	// Allow the next sync to run straight away.
+	var metadata Metadata
+	assert.Nil(json.Unmarshal(cache[METADATA_KEY], &metadata))
+	metadata.LastModifiedTime = time.Unix(0, 0)
+	assert.Nil(updateMetadata(cache, &metadata))
+
+	provider.pullRequests = []*PullRequest{
+		newPullRequest(2, now),
+		newPullRequest(1, now.Add(-time.Hour)),
+	}
+	provider.reviewCalls = 0
+	assert.Nil(Sync(context.Background(), provider, cache, 1))
+	assert.Equal(int32(1), provider.reviewCalls)
+}
+
+func Test_SyncDownloadsConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+	cache := memoryStore{}
+	provider := &fakeProvider{}
+	for number := 20; number > 0; number-- {
+		provider.pullRequests = append(provider.pullRequests, newPullRequest(number, now.Add(-time.Duration(20-number)*time.Minute)))
+	}
+
+	assert.Nil(Sync(context.Background(), provider, cache, DEFAULT_WORKERS))
+	assert.Equal(int32(20), provider.reviewCalls)
+	for number := 1; number <= 20; number++ {
+		assert.Contains(cache, fmt.Sprintf("%d", number))
+	}
+}
+
+func Test_SyncKeepsMetadataWhenADownloadFails(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+	cache := memoryStore{}
+	provider := &fakeProvider{failFiles: 2, pullRequests: []*PullRequest{
+		newPullRequest(3, now),
+		newPullRequest(2, now.Add(-time.Hour)),
+		newPullRequest(1, now.Add(-2*time.Hour)),
+	}}
+
+	assert.Error(Sync(context.Background(), provider, cache, DEFAULT_WORKERS))
+	assert.NotContains(cache, "2")
+
+	var metadata Metadata
+	assert.Nil(json.Unmarshal(cache[METADATA_KEY], &metadata))
+	assert.Equal(-1, metadata.LastPullNumber)
+}
+
+func Test_SyncSkipsDeletedPullRequests(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+	cache := memoryStore{}
+	provider := &fakeProvider{deleted: 2, pullRequests: []*PullRequest{
+		newPullRequest(2, now),
+		newPullRequest(1, now.Add(-time.Hour)),
+	}}
+
+	assert.Nil(Sync(context.Background(), provider, cache, 1))
+	assert.NotContains(cache, "2")
+	assert.Contains(cache, "1")
+}
+
+type fakeCommentProvider struct {
+	fakeProvider
+}
+
+func (f *fakeCommentProvider) ListReviewComments(ctx context.Context, number int) ([]*PullRequestComment, error) {
+	return []*PullRequestComment{{Body: github.String("nit")}}, nil
+}
+
+func (f *fakeCommentProvider) ListComments(ctx context.Context, number int) ([]*IssueComment, error) {
+	return []*IssueComment{}, nil
+}
+
+func Test_SyncWritesCommentsOfCommentProviders(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC()
+
+	cache := memoryStore{}
+	provider := &fakeProvider{pullRequests: []*PullRequest{newPullRequest(1, now)}}
+	assert.Nil(Sync(context.Background(), provider, cache, 1))
+	assert.NotContains(cache, "1/review_comments")
+
+	cache = memoryStore{}
+	commentProvider := &fakeCommentProvider{fakeProvider{pullRequests: []*PullRequest{newPullRequest(1, now)}}}
+	assert.Nil(Sync(context.Background(), commentProvider, cache, 1))
+	assert.Contains(cache, "1/review_comments")
+	assert.Contains(cache, "1/comments")
+}
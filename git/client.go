@@ -0,0 +1,399 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	// EMPTY_TREE is the hash of git's empty tree, used to diff root commits.
+	EMPTY_TREE = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+	fieldSeparator  = "\x1f"
+	recordSeparator = "\x1e"
+)
+
+var _ forge.Provider = (*Client)(nil)
+
+var trailerRegexp = regexp.MustCompile(`(?i)^(reviewed-by|approved-by|co-authored-by):\s*(.*?)\s*<([^>]+)>\s*$`)
+
+type identity struct {
+	Name  string
+	Email string
+}
+
+type commit struct {
+	SHA         string
+	Parents     []string
+	Author      identity
+	AuthoredAt  time.Time
+	Committer   identity
+	CommittedAt time.Time
+	Subject     string
+	Body        string
+}
+
+// changeRequest is a first-parent commit on the analyzed branch along with
+// what we could infer about how it got there.
+type changeRequest struct {
+	Number    int
+	Commit    *commit
+	Author    identity
+	CreatedAt time.Time
+	Reviewers []identity
+	CoAuthors []identity
+}
+
+// Client reads a local clone and treats every commit on the first-parent
+// history of a branch as a merged change request. Reviews come from
+// Reviewed-by and Approved-by trailers, so no API access is needed.
+type Client struct {
+	dir string
+	ref string
+	// mu guards changeRequests, which are read by concurrent downloads while
+	// the history is still being listed.
+	mu             sync.RWMutex
+	changeRequests map[int]*changeRequest
+}
+
+func NewClient(dir, ref string) *Client {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return &Client{
+		dir:            dir,
+		ref:            ref,
+		changeRequests: map[int]*changeRequest{},
+	}
+}
+
+func (c *Client) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", c.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// log returns the commits selected by args, in the order git prints them.
+func (c *Client) log(ctx context.Context, args ...string) ([]*commit, error) {
+	format := strings.Join([]string{"%H", "%P", "%an", "%ae", "%aI", "%cn", "%ce", "%cI", "%s", "%B"}, fieldSeparator) + recordSeparator
+	out, err := c.git(ctx, append([]string{"log", "--format=" + format}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []*commit{}
+	for _, record := range strings.Split(string(out), recordSeparator) {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		fields := strings.Split(record, fieldSeparator)
+		if len(fields) != 10 {
+			return nil, fmt.Errorf("unexpected git log record %q", record)
+		}
+		authoredAt, err := time.Parse(time.RFC3339, fields[4])
+		if err != nil {
+			return nil, err
+		}
+		committedAt, err := time.Parse(time.RFC3339, fields[7])
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &commit{
+			SHA:         fields[0],
+			Parents:     strings.Fields(fields[1]),
+			Author:      identity{Name: fields[2], Email: fields[3]},
+			AuthoredAt:  authoredAt,
+			Committer:   identity{Name: fields[5], Email: fields[6]},
+			CommittedAt: committedAt,
+			Subject:     fields[8],
+			Body:        fields[9],
+		})
+	}
+	return commits, nil
+}
+
+// parseTrailers extracts reviewers and co-authors from a commit message.
+func parseTrailers(message string) (reviewers []identity, coAuthors []identity) {
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	for scanner.Scan() {
+		match := trailerRegexp.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		person := identity{Name: match[2], Email: match[3]}
+		if strings.EqualFold(match[1], "co-authored-by") {
+			coAuthors = append(coAuthors, person)
+		} else {
+			reviewers = append(reviewers, person)
+		}
+	}
+	return reviewers, coAuthors
+}
+
+// login derives a stable login for an identity. GitHub's noreply addresses
+// carry the real login, everything else is identified by email.
+func (i identity) login() string {
+	email := strings.ToLower(i.Email)
+	if strings.HasSuffix(email, "@users.noreply.github.com") {
+		local := strings.TrimSuffix(email, "@users.noreply.github.com")
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[plus+1:]
+		}
+		return local
+	}
+	if email == "" {
+		return strings.ToLower(i.Name)
+	}
+	return email
+}
+
+// isPlatform reports whether the identity is the forge itself rather than a
+// person, such as GitHub committing merges made in its web UI.
+func (i identity) isPlatform() bool {
+	return strings.EqualFold(i.Email, "noreply@github.com") || strings.EqualFold(i.Name, "web-flow")
+}
+
+func (i identity) toUser() *github.User {
+	login := i.login()
+	hash := fnv.New64a()
+	hash.Write([]byte(login))
+	return &github.User{
+		ID:    github.Int64(int64(hash.Sum64() & 0x7fffffffffffffff)),
+		Login: github.String(login),
+		Name:  github.String(i.Name),
+		Email: github.String(i.Email),
+		Type:  github.String("User"),
+	}
+}
+
+// newChangeRequest infers the author and reviewers of a first-parent commit.
+// For merge commits the author is whoever wrote the first commit on the merged
+// branch, and a merger other than the author counts as an approval when the
+// merge carries no review trailers.
+func (c *Client) newChangeRequest(ctx context.Context, number int, cm *commit) (*changeRequest, error) {
+	reviewers, coAuthors := parseTrailers(cm.Body)
+	cr := &changeRequest{
+		Number:    number,
+		Commit:    cm,
+		Author:    cm.Author,
+		CreatedAt: cm.AuthoredAt,
+		Reviewers: reviewers,
+		CoAuthors: coAuthors,
+	}
+
+	if len(cm.Parents) < 2 {
+		return cr, nil
+	}
+
+	branchCommits, err := c.log(ctx, "--reverse", fmt.Sprintf("%s..%s", cm.Parents[0], cm.Parents[1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(branchCommits) == 0 {
+		return cr, nil
+	}
+
+	cr.Author = branchCommits[0].Author
+	cr.CreatedAt = branchCommits[0].AuthoredAt
+	for _, branchCommit := range branchCommits {
+		branchReviewers, branchCoAuthors := parseTrailers(branchCommit.Body)
+		cr.Reviewers = append(cr.Reviewers, branchReviewers...)
+		cr.CoAuthors = append(cr.CoAuthors, branchCoAuthors...)
+	}
+
+	if merger, ok := cr.merger(); ok && len(cr.Reviewers) == 0 && merger.login() != cr.Author.login() {
+		cr.Reviewers = append(cr.Reviewers, merger)
+	}
+	return cr, nil
+}
+
+// merger is whoever landed the change request on the branch. For merge
+// commits that's the author, since GitHub commits merges made in its web UI
+// itself with whoever merged as the author. Otherwise it's the committer,
+// unless that's the forge itself.
+func (cr *changeRequest) merger() (identity, bool) {
+	merger := cr.Commit.Committer
+	if len(cr.Commit.Parents) >= 2 {
+		merger = cr.Commit.Author
+	}
+	return merger, !merger.isPlatform()
+}
+
+func (cr *changeRequest) toPullRequest() *github.PullRequest {
+	createdAt, committedAt := cr.CreatedAt, cr.Commit.CommittedAt
+	assignees := []*github.User{}
+	for _, coAuthor := range cr.CoAuthors {
+		assignees = append(assignees, coAuthor.toUser())
+	}
+	var mergedBy *github.User
+	if merger, ok := cr.merger(); ok {
+		mergedBy = merger.toUser()
+	}
+	return &github.PullRequest{
+		Number:         github.Int(cr.Number),
+		State:          github.String("closed"),
+		Title:          github.String(cr.Commit.Subject),
+		Body:           github.String(cr.Commit.Body),
+		User:           cr.Author.toUser(),
+		MergedBy:       mergedBy,
+		Merged:         github.Bool(true),
+		MergeCommitSHA: github.String(cr.Commit.SHA),
+		CreatedAt:      &createdAt,
+		UpdatedAt:      &committedAt,
+		ClosedAt:       &committedAt,
+		MergedAt:       &committedAt,
+		// Co-authors have no equivalent on a pull request, so they are
+		// recorded as assignees.
+		Assignees: assignees,
+	}
+}
+
+// ListMergedChangeRequests walks the first-parent history of the branch from
+// the newest commit to the oldest. Change requests are numbered by their
+// position in the history, starting at 1 for the root commit, which stays
+// stable as long as the history isn't rewritten.
+func (c *Client) ListMergedChangeRequests(ctx context.Context, since time.Time, fn func(*forge.PullRequest) error) error {
+	commits, err := c.log(ctx, "--first-parent", c.ref)
+	if err != nil {
+		log.Printf("Error reading git log: %v", err)
+		return errors.New("error reading git log")
+	}
+
+	for i, cm := range commits {
+		if !cm.CommittedAt.After(since) {
+			return nil
+		}
+
+		number := len(commits) - i
+		cr, err := c.newChangeRequest(ctx, number, cm)
+		if err != nil {
+			log.Printf("Error reading change request %d: %v", number, err)
+			return errors.New("error reading change request")
+		}
+		c.mu.Lock()
+		c.changeRequests[number] = cr
+		c.mu.Unlock()
+
+		if err := fn(cr.toPullRequest()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) changeRequest(number int) (*changeRequest, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cr, ok := c.changeRequests[number]
+	return cr, ok
+}
+
+// ListReviews turns the reviewers found for the change request into approvals.
+func (c *Client) ListReviews(ctx context.Context, number int) ([]*forge.PullRequestReview, error) {
+	cr, ok := c.changeRequest(number)
+	if !ok {
+		return nil, fmt.Errorf("unknown change request %d", number)
+	}
+
+	allReviews := []*forge.PullRequestReview{}
+	for _, reviewer := range cr.Reviewers {
+		submittedAt := cr.Commit.CommittedAt
+		allReviews = append(allReviews, &forge.PullRequestReview{
+			User:        reviewer.toUser(),
+			State:       github.String("APPROVED"),
+			SubmittedAt: &submittedAt,
+			CommitID:    github.String(cr.Commit.SHA),
+		})
+	}
+	return allReviews, nil
+}
+
+// ListFiles diffs the change request against its first parent.
+func (c *Client) ListFiles(ctx context.Context, number int) ([]*forge.CommitFile, error) {
+	cr, ok := c.changeRequest(number)
+	if !ok {
+		return nil, fmt.Errorf("unknown change request %d", number)
+	}
+
+	parent := EMPTY_TREE
+	if len(cr.Commit.Parents) > 0 {
+		parent = cr.Commit.Parents[0]
+	}
+
+	out, err := c.git(ctx, "diff", "--numstat", "-M", parent, cr.Commit.SHA)
+	if err != nil {
+		log.Printf("Error diffing change request %d: %v", number, err)
+		return nil, errors.New("error diffing change request")
+	}
+	allFiles := parseNumstat(string(out))
+	if parent == EMPTY_TREE {
+		for _, file := range allFiles {
+			file.Status = github.String("added")
+		}
+	}
+	return allFiles, nil
+}
+
+// parseNumstat parses the output of git diff --numstat. Binary files are
+// reported with zero additions and deletions.
+func parseNumstat(numstat string) []*forge.CommitFile {
+	allFiles := []*forge.CommitFile{}
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		additions, _ := strconv.Atoi(fields[0])
+		deletions, _ := strconv.Atoi(fields[1])
+
+		file := &forge.CommitFile{
+			Filename:  github.String(fields[2]),
+			Status:    github.String("modified"),
+			Additions: github.Int(additions),
+			Deletions: github.Int(deletions),
+			Changes:   github.Int(additions + deletions),
+		}
+		// Renames are printed as "old => new" or "dir/{old => new}/file".
+		if strings.Contains(fields[2], " => ") {
+			previous, current := expandRename(fields[2])
+			file.Filename = github.String(current)
+			file.PreviousFilename = github.String(previous)
+			file.Status = github.String("renamed")
+		}
+		allFiles = append(allFiles, file)
+	}
+	return allFiles
+}
+
+func expandRename(path string) (string, string) {
+	start, end := strings.Index(path, "{"), strings.Index(path, "}")
+	if start < 0 || end < start {
+		parts := strings.SplitN(path, " => ", 2)
+		return parts[0], parts[1]
+	}
+	parts := strings.SplitN(path[start+1:end], " => ", 2)
+	prefix, suffix := path[:start], path[end+1:]
+	previous := strings.ReplaceAll(prefix+parts[0]+suffix, "//", "/")
+	current := strings.ReplaceAll(prefix+parts[1]+suffix, "//", "/")
+	return previous, current
+}
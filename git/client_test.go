@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTrailers(t *testing.T) {
+	assert := assert.New(t)
+	message := `Fix the frobnicator
+
+Reviewed-by: Jane Doe <jane@example.com>
+approved-by: John <john@example.com>
+Co-authored-by: Octo Cat <1234+octocat@users.noreply.github.com>
+Signed-off-by: Jane Doe <jane@example.com>
+`
+	reviewers, coAuthors := parseTrailers(message)
+	assert.Equal([]identity{
+		{Name: "Jane Doe", Email: "jane@example.com"},
+		{Name: "John", Email: "john@example.com"},
+	}, reviewers)
+	assert.Len(coAuthors, 1)
+	assert.Equal("octocat", coAuthors[0].login())
+}
+
+func Test_IdentityIsStable(t *testing.T) {
+	assert := assert.New(t)
+	a := identity{Name: "Jane", Email: "Jane@Example.com"}
+	b := identity{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.Equal(a.toUser().GetID(), b.toUser().GetID())
+	assert.Equal("jane@example.com", a.login())
+}
+
+func Test_ParseNumstat(t *testing.T) {
+	assert := assert.New(t)
+	files := parseNumstat("3\t1\tmain.go\n-\t-\tlogo.png\n0\t0\tgraph/{old.go => new.go}\n")
+	assert.Len(files, 3)
+	assert.Equal("main.go", files[0].GetFilename())
+	assert.Equal(3, files[0].GetAdditions())
+	assert.Equal(0, files[1].GetChanges())
+	assert.Equal("graph/new.go", files[2].GetFilename())
+	assert.Equal("graph/old.go", files[2].GetPreviousFilename())
+	assert.Equal("renamed", files[2].GetStatus())
+}
+
+// gitAs runs git in dir with the given author and committer.
+func gitAs(t *testing.T, dir string, author, committer identity, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+author.Name, "GIT_AUTHOR_EMAIL="+author.Email,
+		"GIT_COMMITTER_NAME="+committer.Name, "GIT_COMMITTER_EMAIL="+committer.Email,
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func Test_ListMergedChangeRequests(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	assert := assert.New(t)
+	dir := t.TempDir()
+	alice := identity{Name: "Alice", Email: "alice@example.com"}
+	bob := identity{Name: "Bob", Email: "bob@example.com"}
+	carol := identity{Name: "Carol", Email: "carol@example.com"}
+	webFlow := identity{Name: "GitHub", Email: "noreply@github.com"}
+
+	commitFile := func(author identity, name, message string) {
+		assert.Nil(os.WriteFile(fmt.Sprintf("%s/%s", dir, name), []byte(name), 0o644))
+		gitAs(t, dir, author, author, "add", name)
+		gitAs(t, dir, author, author, "commit", "-m", message)
+	}
+
+	gitAs(t, dir, alice, alice, "init", "-b", "main")
+	commitFile(alice, "a.go", "Add a")
+	commitFile(alice, "b.go", "Add b\n\nReviewed-by: Bob <bob@example.com>")
+
+	// carol's branch is merged by bob in GitHub's web UI.
+	gitAs(t, dir, carol, carol, "checkout", "-b", "feature")
+	commitFile(carol, "c.go", "Add c")
+	gitAs(t, dir, carol, carol, "checkout", "main")
+	gitAs(t, dir, bob, webFlow, "merge", "--no-ff", "-m", "Merge feature", "feature")
+
+	client := NewClient(dir, "main")
+	pullRequests := []*forge.PullRequest{}
+	assert.Nil(client.ListMergedChangeRequests(context.Background(), time.Unix(0, 0), func(pr *forge.PullRequest) error {
+		pullRequests = append(pullRequests, pr)
+		return nil
+	}))
+	assert.Len(pullRequests, 3)
+
+	reviewerLogins := func(number int) []string {
+		reviews, err := client.ListReviews(context.Background(), number)
+		assert.Nil(err)
+		logins := []string{}
+		for _, review := range reviews {
+			logins = append(logins, review.GetUser().GetLogin())
+		}
+		return logins
+	}
+
+	merge := pullRequests[0]
+	assert.Equal(3, merge.GetNumber())
+	assert.Equal("carol@example.com", merge.GetUser().GetLogin())
+	assert.Equal("bob@example.com", merge.GetMergedBy().GetLogin())
+	assert.Equal([]string{"bob@example.com"}, reviewerLogins(3))
+
+	trailer := pullRequests[1]
+	assert.Equal("alice@example.com", trailer.GetUser().GetLogin())
+	assert.Equal([]string{"bob@example.com"}, reviewerLogins(2))
+
+	assert.Empty(reviewerLogins(1))
+
+	files, err := client.ListFiles(context.Background(), 3)
+	assert.Nil(err)
+	assert.Len(files, 1)
+	assert.Equal("c.go", files[0].GetFilename())
+}
+
+func Test_MergesByTheForgeHaveNoMerger(t *testing.T) {
+	webFlow := identity{Name: "GitHub", Email: "noreply@github.com"}
+	cr := &changeRequest{
+		Author: identity{Name: "Carol", Email: "carol@example.com"},
+		Commit: &commit{Parents: []string{"a", "b"}, Author: webFlow, Committer: webFlow},
+	}
+	_, ok := cr.merger()
+	assert.False(t, ok)
+	assert.Nil(t, cr.toPullRequest().MergedBy)
+}
@@ -2,42 +2,38 @@ package github
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
 	"github.com/mentallyanimated/reporeportcard-core/store"
 	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 )
 
 const (
-	METADATA_KEY = "metadata"
+	METADATA_KEY = forge.METADATA_KEY
 )
 
 // PullRequest is a type alias for github.PullRequest
-type PullRequest = github.PullRequest
+type PullRequest = forge.PullRequest
 
-type PullRequestReview = github.PullRequestReview
+type PullRequestReview = forge.PullRequestReview
 
-type CommitFile = github.CommitFile
+type CommitFile = forge.CommitFile
 
-type PullDetails struct {
-	PullRequest *PullRequest
-	Reviews     []*PullRequestReview
-	Files       []*CommitFile
-}
+type PullDetails = forge.PullDetails
 
-// Metadata let's us store additional information about the data we're storing
-// Such as when we might need or want to redownload data
-type Metadata struct {
-	LastModifiedTime time.Time `json:"lastModifiedTime"`
-	LastPullNumber   int       `json:"lastPullNumber"`
-}
+type Metadata = forge.Metadata
+
+var (
+	_ forge.Provider        = (*Client)(nil)
+	_ forge.CommentProvider = (*Client)(nil)
+	_ forge.CommitProvider  = (*Client)(nil)
+	_ forge.EventProvider   = (*Client)(nil)
+)
 
 type Client struct {
 	cache   store.Store
@@ -45,22 +41,22 @@ type Client struct {
 	owner   string
 	repo    string
 	limiter *rate.Limiter
+	// maxAttempts and baseBackoff control how failed requests are retried.
+	maxAttempts int
+	baseBackoff time.Duration
 }
 
-func waitForRatelimit(r *github.Response) {
-	if r.StatusCode == 403 {
-		for time.Now().Before(r.Rate.Reset.Time) {
-			log.Printf("API Rate limit exceeded. Sleeping for %v", r.Rate.Reset.Sub(time.Now()))
-			time.Sleep(time.Minute * 5)
-		}
-
-		retryAfter := r.Header.Get("Retry-After")
-		if retryAfter != "" {
-			wait, _ := strconv.Atoi(retryAfter)
-			log.Printf("Abuse rate limit exceeded. Sleeping for %v", time.Duration(wait)*time.Second)
-			time.Sleep(time.Duration(wait) * time.Second)
-		}
+// updateRate spreads the requests left in the current rate limit window,
+// from the X-RateLimit-Remaining header, evenly over the time until it resets.
+// The limiter is shared by every concurrent download of the client, so this
+// speeds them up while there's quota to spare and slows them down before it
+// runs out.
+func (c *Client) updateRate(r *github.Response) {
+	untilReset := time.Until(r.Rate.Reset.Time)
+	if r.Rate.Remaining == 0 || untilReset <= 0 {
+		return
 	}
+	c.limiter.SetLimit(rate.Limit(float64(r.Rate.Remaining) / untilReset.Seconds()))
 }
 
 func NewClient(ctx context.Context, token string, cache store.Store, owner, repo string) *Client {
@@ -73,62 +69,115 @@ func NewClient(ctx context.Context, token string, cache store.Store, owner, repo
 		owner:   owner,
 		repo:    repo,
 		limiter: rate.NewLimiter(rate.Limit(5000/3600), 1),
+
+		maxAttempts: DEFAULT_MAX_ATTEMPTS,
+		baseBackoff: DEFAULT_BASE_BACKOFF,
 	}
 }
 
-func (c *Client) readOrCreateMetadata(ctx context.Context) (*Metadata, error) {
-	metadata := &Metadata{
-		// Never modified
-		LastModifiedTime: time.Unix(0, 0).UTC(),
-		LastPullNumber:   -1,
+// ListOrgRepositories returns the "owner/repo" names of every repository in
+// the organization.
+func ListOrgRepositories(ctx context.Context, token, org string) ([]string, error) {
+	return NewClient(ctx, token, nil, org, "").listOrgRepositories(ctx)
+}
+
+// ListOrgTeams returns the member logins of every team of a GitHub
+// organization, keyed by team slug.
+func ListOrgTeams(ctx context.Context, token, org string) (map[string][]string, error) {
+	return NewClient(ctx, token, nil, org, "").listOrgTeams(ctx)
+}
+
+// listOrgRepositories lists the repositories of the client's owner, which is
+// the organization.
+func (c *Client) listOrgRepositories(ctx context.Context) ([]string, error) {
+	repos := []string{}
+	opt := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		var repositories []*github.Repository
+		resp, err := c.do(ctx, fmt.Sprintf("listing repositories of %s", c.owner), func() (resp *github.Response, err error) {
+			repositories, resp, err = c.client.Repositories.ListByOrg(ctx, c.owner, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, repository := range repositories {
+			repos = append(repos, repository.GetFullName())
+		}
+
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opt.Page = resp.NextPage
 	}
-	metadataContents, err := c.cache.Get(METADATA_KEY)
-	if err != nil {
-		if err == store.ErrNotFound {
-			metadataBytes, err := json.Marshal(metadata)
+}
+
+func (c *Client) listOrgTeams(ctx context.Context) (map[string][]string, error) {
+	teams := map[string][]string{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		var orgTeams []*github.Team
+		resp, err := c.do(ctx, fmt.Sprintf("listing teams of %s", c.owner), func() (resp *github.Response, err error) {
+			orgTeams, resp, err = c.client.Teams.ListTeams(ctx, c.owner, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, team := range orgTeams {
+			members, err := c.listTeamMembers(ctx, team.GetSlug())
 			if err != nil {
-				log.Printf("Error marshalling metadata: %v", err)
-				return nil, errors.New("error marshalling metadata")
+				return nil, err
 			}
-			if err := c.cache.Put(METADATA_KEY, metadataBytes); err != nil {
-				log.Printf("Error saving metadata: %v", err)
-				return nil, errors.New("error saving metadata")
-			}
-		} else {
-			log.Printf("Error getting metadata: %v", err)
+			teams[team.GetSlug()] = members
 		}
-	} else {
-		if err := json.Unmarshal(metadataContents, metadata); err != nil {
-			log.Printf("Error unmarshalling metadata: %v", err)
-			return nil, errors.New("error unmarshalling metadata")
+
+		if resp.NextPage == 0 {
+			return teams, nil
 		}
+		opt.Page = resp.NextPage
 	}
-	return metadata, nil
 }
 
-func (c *Client) updateMetadata(ctx context.Context, metadata *Metadata) error {
-	metadataBytes, err := json.Marshal(metadata)
-	if err != nil {
-		log.Printf("Error marshalling metadata: %v", err)
-		return errors.New("error marshalling metadata")
+func (c *Client) listTeamMembers(ctx context.Context, slug string) ([]string, error) {
+	members := []string{}
+	opt := &github.TeamListTeamMembersOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
 	}
-	if err := c.cache.Put(METADATA_KEY, metadataBytes); err != nil {
-		log.Printf("Error saving metadata: %v", err)
-		return errors.New("error saving metadata")
+	for {
+		var users []*github.User
+		resp, err := c.do(ctx, fmt.Sprintf("listing members of team %s", slug), func() (resp *github.Response, err error) {
+			users, resp, err = c.client.Teams.ListTeamMembersBySlug(ctx, c.owner, slug, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			members = append(members, user.GetLogin())
+		}
+
+		if resp.NextPage == 0 {
+			return members, nil
+		}
+		opt.Page = resp.NextPage
 	}
-	return nil
 }
 
-func (c *Client) downloadReviews(ctx context.Context, pullNumber int) ([]*github.PullRequestReview, error) {
+// ListReviews returns every review of the pull request.
+func (c *Client) ListReviews(ctx context.Context, pullNumber int) ([]*github.PullRequestReview, error) {
 	allReviews := []*github.PullRequestReview{}
 	opt := &github.ListOptions{}
 	for {
-		c.limiter.Wait(ctx)
-		reviews, resp, err := c.client.PullRequests.ListReviews(ctx, c.owner, c.repo, pullNumber, opt)
+		var reviews []*github.PullRequestReview
+		resp, err := c.do(ctx, fmt.Sprintf("listing reviews of %d", pullNumber), func() (resp *github.Response, err error) {
+			reviews, resp, err = c.client.PullRequests.ListReviews(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
 		if err != nil {
-			log.Printf("Error listing reviews: %v", err)
-			waitForRatelimit(resp)
-			continue
+			return nil, err
 		}
 		allReviews = append(allReviews, reviews...)
 
@@ -138,27 +187,22 @@ func (c *Client) downloadReviews(ctx context.Context, pullNumber int) ([]*github
 		opt.Page = resp.NextPage
 	}
 
-	reviewBytes, err := json.Marshal(allReviews)
-	if err != nil {
-		log.Printf("Error marshalling pull request review: %v", err)
-		return nil, errors.New("error marshalling pull request review")
-	}
-	c.cache.Put(fmt.Sprintf("%d/reviews", pullNumber), reviewBytes)
-
 	log.Printf("Downloaded pull requests reviews for %d", pullNumber)
 	return allReviews, nil
 }
 
-func (c *Client) downloadFiles(ctx context.Context, pullNumber int) ([]*github.CommitFile, error) {
+// ListFiles returns every file changed by the pull request.
+func (c *Client) ListFiles(ctx context.Context, pullNumber int) ([]*github.CommitFile, error) {
 	allFiles := []*github.CommitFile{}
 	opt := &github.ListOptions{}
 	for {
-		c.limiter.Wait(ctx)
-		files, resp, err := c.client.PullRequests.ListFiles(ctx, c.owner, c.repo, pullNumber, opt)
+		var files []*github.CommitFile
+		resp, err := c.do(ctx, fmt.Sprintf("listing files of %d", pullNumber), func() (resp *github.Response, err error) {
+			files, resp, err = c.client.PullRequests.ListFiles(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
 		if err != nil {
-			log.Printf("Error listing files: %v", err)
-			waitForRatelimit(resp)
-			continue
+			return nil, err
 		}
 		allFiles = append(allFiles, files...)
 
@@ -168,102 +212,157 @@ func (c *Client) downloadFiles(ctx context.Context, pullNumber int) ([]*github.C
 		opt.Page = resp.NextPage
 	}
 
-	fileBytes, err := json.Marshal(allFiles)
-	if err != nil {
-		log.Printf("Error marshalling pull request files: %v", err)
-		return nil, errors.New("error marshalling pull request files")
-	}
-	c.cache.Put(fmt.Sprintf("%d/files", pullNumber), fileBytes)
-
 	log.Printf("Downloaded pull requests files for %d", pullNumber)
 	return allFiles, nil
 }
 
-func (c *Client) DownloadPullDetails(ctx context.Context) error {
-	metadata, err := c.readOrCreateMetadata(ctx)
-	if err != nil {
-		return err
+// ListReviewComments returns every inline comment on the pull request's diff.
+func (c *Client) ListReviewComments(ctx context.Context, pullNumber int) ([]*github.PullRequestComment, error) {
+	allComments := []*github.PullRequestComment{}
+	opt := &github.PullRequestListCommentsOptions{}
+	for {
+		var comments []*github.PullRequestComment
+		resp, err := c.do(ctx, fmt.Sprintf("listing review comments of %d", pullNumber), func() (resp *github.Response, err error) {
+			comments, resp, err = c.client.PullRequests.ListComments(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		allComments = append(allComments, comments...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
 	}
 
-	// check metadata to see if we need to update
+	log.Printf("Downloaded pull requests review comments for %d", pullNumber)
+	return allComments, nil
+}
 
-	WAIT_TIME := -time.Second * 20
-	if metadata.LastModifiedTime.After(time.Now().Add(WAIT_TIME)) {
-		log.Printf("LastModifiedTime is %v, not updating", metadata.LastModifiedTime)
-		duration := -time.Now().Add(WAIT_TIME).Sub(metadata.LastModifiedTime)
-		log.Printf("Will update in %v", duration)
-		return nil
+// ListComments returns every conversation comment on the pull request.
+func (c *Client) ListComments(ctx context.Context, pullNumber int) ([]*github.IssueComment, error) {
+	allComments := []*github.IssueComment{}
+	opt := &github.IssueListCommentsOptions{}
+	for {
+		var comments []*github.IssueComment
+		resp, err := c.do(ctx, fmt.Sprintf("listing comments of %d", pullNumber), func() (resp *github.Response, err error) {
+			comments, resp, err = c.client.Issues.ListComments(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		allComments = append(allComments, comments...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
 	}
 
-	log.Printf("Metadata: %#v", metadata)
+	log.Printf("Downloaded pull requests comments for %d", pullNumber)
+	return allComments, nil
+}
 
-	allPullDetails := []*PullDetails{}
-	opt := &github.PullRequestListOptions{}
-	defer func(allPullDetails *[]*PullDetails) {
-		if 0 < len(*allPullDetails) {
-			c.updateMetadata(ctx, &Metadata{
-				LastModifiedTime: time.Now().UTC(),
-				LastPullNumber:   (*allPullDetails)[0].PullRequest.GetNumber(),
-			})
+// ListCommits returns every commit of the pull request.
+func (c *Client) ListCommits(ctx context.Context, pullNumber int) ([]*github.RepositoryCommit, error) {
+	allCommits := []*github.RepositoryCommit{}
+	opt := &github.ListOptions{}
+	for {
+		var commits []*github.RepositoryCommit
+		resp, err := c.do(ctx, fmt.Sprintf("listing commits of %d", pullNumber), func() (resp *github.Response, err error) {
+			commits, resp, err = c.client.PullRequests.ListCommits(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		allCommits = append(allCommits, commits...)
+
+		if resp.NextPage == 0 {
+			break
 		}
-	}(&allPullDetails)
+		opt.Page = resp.NextPage
+	}
+
+	log.Printf("Downloaded pull requests commits for %d", pullNumber)
+	return allCommits, nil
+}
+
+// ListEvents returns every event of the pull request, such as review
+// requests.
+func (c *Client) ListEvents(ctx context.Context, pullNumber int) ([]*github.IssueEvent, error) {
+	allEvents := []*github.IssueEvent{}
+	opt := &github.ListOptions{}
+	for {
+		var events []*github.IssueEvent
+		resp, err := c.do(ctx, fmt.Sprintf("listing events of %d", pullNumber), func() (resp *github.Response, err error) {
+			events, resp, err = c.client.Issues.ListIssueEvents(ctx, c.owner, c.repo, pullNumber, opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		allEvents = append(allEvents, events...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
 
+	log.Printf("Downloaded pull requests events for %d", pullNumber)
+	return allEvents, nil
+}
+
+// ListMergedChangeRequests lists closed pull requests sorted by updated_at and
+// calls fn for the merged ones updated after since.
+func (c *Client) ListMergedChangeRequests(ctx context.Context, since time.Time, fn func(*PullRequest) error) error {
+	opt := &github.PullRequestListOptions{}
 	for {
-		c.limiter.Wait(ctx)
-
-		pullRequests, resp, err := c.client.PullRequests.List(ctx, c.owner, c.repo, &github.PullRequestListOptions{
-			State: "closed",
-			ListOptions: github.ListOptions{
-				Page:    opt.Page,
-				PerPage: 100,
-			},
+		var pullRequests []*github.PullRequest
+		resp, err := c.do(ctx, "listing pull requests", func() (resp *github.Response, err error) {
+			pullRequests, resp, err = c.client.PullRequests.List(ctx, c.owner, c.repo, &github.PullRequestListOptions{
+				State:     "closed",
+				Sort:      "updated",
+				Direction: "desc",
+				ListOptions: github.ListOptions{
+					Page:    opt.Page,
+					PerPage: 100,
+				},
+			})
+			return resp, err
 		})
 		if err != nil {
-			log.Printf("Error listing pull requests: %v", err)
-			waitForRatelimit(resp)
-			continue
+			return err
 		}
 
 		for _, pr := range pullRequests {
-			if pr.GetNumber() <= metadata.LastPullNumber {
-				log.Printf("Downloaded all pull requests up to previously last downloaded. Exiting early.")
+			if !pr.GetUpdatedAt().After(since) {
+				log.Printf("Listed all pull requests updated since %v. Exiting early.", since)
 				return nil
 			}
 
-			if pr.MergedAt != nil {
-				prBytes, err := json.Marshal(pr)
-				if err != nil {
-					log.Printf("Error marshalling pull request: %v", err)
-					return errors.New("error marshalling pull request")
-				}
-				c.cache.Put(fmt.Sprintf("%d", pr.GetNumber()), prBytes)
-
-				reviews, err := c.downloadReviews(ctx, pr.GetNumber())
-				if err != nil {
-					log.Printf("Error downloading reviews: %v", err)
-					return errors.New("error downloading reviews")
-				}
-
-				files, err := c.downloadFiles(ctx, pr.GetNumber())
-				if err != nil {
-					log.Printf("Error downloading files: %v", err)
-					return errors.New("error downloading files")
-				}
-
-				allPullDetails = append(allPullDetails, &PullDetails{
-					PullRequest: pr,
-					Reviews:     reviews,
-					Files:       files,
-				})
+			if pr.MergedAt == nil {
+				continue
+			}
+
+			if err := fn(pr); err != nil {
+				return err
 			}
 		}
 
 		if resp.NextPage == 0 {
-			break
+			return nil
 		}
 		opt.Page = resp.NextPage
-		log.Printf("Last downloaded: %d", allPullDetails[len(allPullDetails)-1].PullRequest.GetNumber())
 	}
-	log.Printf("Downloaded %d pull requests", len(allPullDetails))
-	return nil
+}
+
+// DownloadPullDetails syncs the repository's merged pull requests into the
+// client's store.
+func (c *Client) DownloadPullDetails(ctx context.Context) error {
+	return forge.Sync(ctx, c, c.cache, forge.DEFAULT_WORKERS)
 }
@@ -0,0 +1,166 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	ERROR_NETWORK     = "network"
+	ERROR_SERVER      = "server"
+	ERROR_RATE_LIMIT  = "rate limit"
+	ERROR_ABUSE_LIMIT = "secondary rate limit"
+	ERROR_NOT_FOUND   = "not found"
+	ERROR_CLIENT      = "client"
+
+	DEFAULT_MAX_ATTEMPTS = 6
+	DEFAULT_BASE_BACKOFF = time.Second
+	MAX_BACKOFF          = 5 * time.Minute
+)
+
+// Error is returned once a request is given up on, either because its error
+// isn't worth retrying or because every attempt failed.
+type Error struct {
+	// Kind is one of the ERROR_ constants.
+	Kind       string
+	Op         string
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s error after %d attempts: %v", e.Op, e.Kind, e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is match a not found Error with forge.ErrNotFound.
+func (e *Error) Is(target error) bool {
+	return target == forge.ErrNotFound && e.Kind == ERROR_NOT_FOUND
+}
+
+// classify works out the kind of a failed request. GitHub answers both rate
+// limits with a 403, and secondary limits are only recognized by go-github
+// when they link to the old abuse rate limit documentation, so the message
+// and Retry-After header are checked as well.
+func classify(resp *github.Response, err error) string {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return ERROR_RATE_LIMIT
+	case errors.As(err, &abuseErr):
+		return ERROR_ABUSE_LIMIT
+	case resp == nil:
+		return ERROR_NETWORK
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ERROR_ABUSE_LIMIT
+	case resp.StatusCode == http.StatusForbidden && (resp.Header.Get("Retry-After") != "" || strings.Contains(strings.ToLower(err.Error()), "secondary rate limit")):
+		return ERROR_ABUSE_LIMIT
+	case resp.StatusCode == http.StatusNotFound:
+		return ERROR_NOT_FOUND
+	case resp.StatusCode >= 500:
+		return ERROR_SERVER
+	default:
+		return ERROR_CLIENT
+	}
+}
+
+// backoff doubles the wait with every attempt, up to MAX_BACKOFF, and picks a
+// random wait between half of it and all of it so concurrent downloads don't
+// retry in lockstep.
+func backoff(base time.Duration, attempt int) time.Duration {
+	wait := MAX_BACKOFF
+	if attempt < 32 && base<<uint(attempt-1) < MAX_BACKOFF {
+		wait = base << uint(attempt-1)
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// retryWait returns how long to wait before retrying a request that failed
+// with an error of the given kind, and false when it shouldn't be retried.
+func retryWait(kind string, resp *github.Response, err error, base time.Duration, attempt int) (time.Duration, bool) {
+	switch kind {
+	case ERROR_RATE_LIMIT:
+		var rateLimitErr *github.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			if wait := time.Until(rateLimitErr.Rate.Reset.Time); wait > 0 {
+				return wait + time.Second, true
+			}
+		}
+		return backoff(base, attempt), true
+	case ERROR_ABUSE_LIMIT:
+		var abuseErr *github.AbuseRateLimitError
+		if errors.As(err, &abuseErr) && abuseErr.GetRetryAfter() > 0 {
+			return abuseErr.GetRetryAfter(), true
+		}
+		if resp != nil {
+			if seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After")); seconds > 0 {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+		// GitHub asks for at least a minute between retries without a
+		// Retry-After.
+		if wait := backoff(base, attempt); wait > time.Minute {
+			return wait, true
+		}
+		return time.Minute, true
+	case ERROR_NETWORK, ERROR_SERVER:
+		return backoff(base, attempt), true
+	default:
+		return 0, false
+	}
+}
+
+// do calls request, waiting for the limiter shared by every download of the
+// client before each attempt, until it succeeds, fails with an error that
+// isn't worth retrying or has been attempted maxAttempts times. Cancelling
+// ctx stops it straight away with the context's error.
+func (c *Client) do(ctx context.Context, op string, request func() (*github.Response, error)) (*github.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := request()
+		if err == nil {
+			c.updateRate(resp)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		kind := classify(resp, err)
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		wait, retry := retryWait(kind, resp, err, c.baseBackoff, attempt)
+		if !retry || attempt >= c.maxAttempts {
+			return resp, &Error{Kind: kind, Op: op, StatusCode: statusCode, Attempts: attempt, Err: err}
+		}
+
+		log.Printf("Error %s, %s error, retrying in %v (attempt %d of %d): %v", op, kind, wait, attempt, c.maxAttempts, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
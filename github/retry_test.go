@@ -0,0 +1,206 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+type testResponse struct {
+	statusCode int
+	header     map[string]string
+	body       string
+}
+
+// newTestClient returns a client of a server answering every request with the
+// next status code, repeating the last one once they run out.
+func newTestClient(t *testing.T, statusCodes ...int) (*Client, *int) {
+	responses := []testResponse{}
+	for _, statusCode := range statusCodes {
+		responses = append(responses, testResponse{statusCode: statusCode, body: "[]"})
+	}
+	return newTestClientWithResponses(t, responses...)
+}
+
+// newTestClientWithResponses is newTestClient with headers and bodies.
+func newTestClientWithResponses(t *testing.T, responses ...testResponse) (*Client, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := responses[len(responses)-1]
+		if requests < len(responses) {
+			response = responses[requests]
+		}
+		requests++
+		for key, value := range response.header {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(response.statusCode)
+		w.Write([]byte(response.body))
+	}))
+	t.Cleanup(server.Close)
+
+	githubClient := github.NewClient(nil)
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+	return &Client{
+		client:      githubClient,
+		owner:       "o",
+		repo:        "r",
+		limiter:     rate.NewLimiter(rate.Inf, 1),
+		maxAttempts: 3,
+		baseBackoff: time.Millisecond,
+	}, &requests
+}
+
+func Test_RetriesServerErrors(t *testing.T) {
+	client, requests := newTestClient(t, http.StatusBadGateway, http.StatusOK)
+	reviews, err := client.ListReviews(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Empty(t, reviews)
+	assert.Equal(t, 2, *requests)
+}
+
+func Test_GivesUpAfterMaxAttempts(t *testing.T) {
+	client, requests := newTestClient(t, http.StatusInternalServerError)
+	_, err := client.ListFiles(context.Background(), 1)
+
+	var githubErr *Error
+	assert.True(t, errors.As(err, &githubErr))
+	assert.Equal(t, ERROR_SERVER, githubErr.Kind)
+	assert.Equal(t, http.StatusInternalServerError, githubErr.StatusCode)
+	assert.Equal(t, 3, githubErr.Attempts)
+	assert.Equal(t, 3, *requests)
+}
+
+func Test_DoesNotRetryNotFound(t *testing.T) {
+	client, requests := newTestClient(t, http.StatusNotFound)
+	_, err := client.ListCommits(context.Background(), 1)
+	assert.True(t, errors.Is(err, forge.ErrNotFound))
+	assert.Equal(t, 1, *requests)
+}
+
+func Test_StopsWhenCancelled(t *testing.T) {
+	client, _ := newTestClient(t, http.StatusInternalServerError)
+	client.baseBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := client.ListEvents(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func Test_Backoff(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		wait := backoff(time.Second, attempt)
+		max := MAX_BACKOFF
+		if attempt < 10 {
+			max = time.Second << uint(attempt-1)
+		}
+		assert.True(t, wait >= max/2 && wait <= max, "attempt %d waited %v", attempt, wait)
+	}
+}
+
+func Test_RateLimits(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	tests := []struct {
+		name     string
+		response testResponse
+		kind     string
+		minWait  time.Duration
+		maxWait  time.Duration
+	}{
+		{
+			name: "primary",
+			response: testResponse{
+				statusCode: http.StatusForbidden,
+				header:     map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset},
+				body:       `{"message": "API rate limit exceeded"}`,
+			},
+			kind:    ERROR_RATE_LIMIT,
+			minWait: 59 * time.Minute,
+			maxWait: time.Hour + time.Second,
+		},
+		{
+			name: "secondary with Retry-After",
+			response: testResponse{
+				statusCode: http.StatusForbidden,
+				header:     map[string]string{"Retry-After": "30"},
+				body:       `{"message": "You have exceeded a secondary rate limit"}`,
+			},
+			kind:    ERROR_ABUSE_LIMIT,
+			minWait: 30 * time.Second,
+			maxWait: 30 * time.Second,
+		},
+		{
+			name: "secondary without Retry-After",
+			response: testResponse{
+				statusCode: http.StatusForbidden,
+				body:       `{"message": "You have exceeded a secondary rate limit"}`,
+			},
+			kind:    ERROR_ABUSE_LIMIT,
+			minWait: time.Minute,
+			maxWait: time.Minute,
+		},
+		{
+			name: "too many requests",
+			response: testResponse{
+				statusCode: http.StatusTooManyRequests,
+				header:     map[string]string{"Retry-After": "5"},
+			},
+			kind:    ERROR_ABUSE_LIMIT,
+			minWait: 5 * time.Second,
+			maxWait: 5 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestClientWithResponses(t, test.response)
+			ctx := context.Background()
+			_, resp, err := client.client.PullRequests.ListReviews(ctx, client.owner, client.repo, 1, nil)
+			kind := classify(resp, err)
+			assert.Equal(t, test.kind, kind)
+
+			wait, retry := retryWait(kind, resp, err, client.baseBackoff, 1)
+			assert.True(t, retry)
+			assert.True(t, wait >= test.minWait && wait <= test.maxWait, "waited %v", wait)
+		})
+	}
+}
+
+func Test_RetriesRateLimitedOrgListing(t *testing.T) {
+	// A reset in the past is retried with the usual backoff.
+	reset := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	client, requests := newTestClientWithResponses(t,
+		testResponse{
+			statusCode: http.StatusForbidden,
+			header:     map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset},
+			body:       `{"message": "API rate limit exceeded"}`,
+		},
+		testResponse{statusCode: http.StatusOK, body: `[{"full_name": "o/a"}]`},
+	)
+	repos, err := client.listOrgRepositories(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"o/a"}, repos)
+	assert.Equal(t, 2, *requests)
+}
+
+func Test_RetriesOrgTeams(t *testing.T) {
+	client, requests := newTestClientWithResponses(t,
+		testResponse{statusCode: http.StatusOK, body: `[{"slug": "core"}]`},
+		testResponse{statusCode: http.StatusBadGateway},
+		testResponse{statusCode: http.StatusOK, body: `[{"login": "alice"}]`},
+	)
+	teams, err := client.listOrgTeams(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"core": {"alice"}}, teams)
+	assert.Equal(t, 3, *requests)
+}
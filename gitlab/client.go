@@ -0,0 +1,408 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DEFAULT_BASE_URL = "https://gitlab.com"
+
+	// DEFAULT_MAX_ATTEMPTS bounds how many times a rate limited request is
+	// sent before giving up.
+	DEFAULT_MAX_ATTEMPTS = 6
+	// DEFAULT_RETRY_AFTER is how long to wait after a 429 without a
+	// Retry-After header.
+	DEFAULT_RETRY_AFTER = time.Minute
+
+	REVIEWER_STATE_REQUESTED_CHANGES = "requested_changes"
+)
+
+var _ forge.Provider = (*Client)(nil)
+
+type user struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	WebURL   string `json:"web_url"`
+}
+
+type mergeRequest struct {
+	ID           int64      `json:"id"`
+	IID          int        `json:"iid"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	WebURL       string     `json:"web_url"`
+	Author       *user      `json:"author"`
+	MergedBy     *user      `json:"merged_by"`
+	MergeUser    *user      `json:"merge_user"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	MergedAt     *time.Time `json:"merged_at"`
+	ClosedAt     *time.Time `json:"closed_at"`
+	SourceBranch string     `json:"source_branch"`
+	TargetBranch string     `json:"target_branch"`
+	SHA          string     `json:"sha"`
+}
+
+type note struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	Author    *user     `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	System    bool      `json:"system"`
+}
+
+// approvals is the approval state of a merge request. Only current approvals
+// are listed, so revoked approvals don't show up. approved_at is missing on
+// older GitLab versions, where the merge request's updated_at is used instead.
+type approvals struct {
+	UpdatedAt  time.Time `json:"updated_at"`
+	ApprovedBy []struct {
+		User       *user      `json:"user"`
+		ApprovedAt *time.Time `json:"approved_at"`
+	} `json:"approved_by"`
+}
+
+// reviewer is a requested reviewer of a merge request. The API doesn't say when
+// the state last changed, so created_at, when the review was requested, is
+// used as the time of the review.
+type reviewer struct {
+	User      *user     `json:"user"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type change struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	Diff        string `json:"diff"`
+}
+
+// Client downloads merge requests from the GitLab REST API and normalizes them
+// into pull requests. It works against gitlab.com as well as self-hosted
+// instances.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	owner      string
+	repo       string
+	limiter    *rate.Limiter
+
+	maxAttempts int
+	retryAfter  time.Duration
+}
+
+func NewClient(baseURL, token, owner, repo string) *Client {
+	if baseURL == "" {
+		baseURL = DEFAULT_BASE_URL
+	}
+	return &Client{
+		httpClient: &http.Client{Timeout: time.Minute},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		owner:      owner,
+		repo:       repo,
+		limiter:    rate.NewLimiter(rate.Limit(10), 1),
+
+		maxAttempts: DEFAULT_MAX_ATTEMPTS,
+		retryAfter:  DEFAULT_RETRY_AFTER,
+	}
+}
+
+// projectPath is the URL-encoded project identifier. The owner may be a nested
+// group such as "group/subgroup".
+func (c *Client) projectPath() string {
+	return fmt.Sprintf("%s/api/v4/projects/%s", c.baseURL, url.PathEscape(c.owner+"/"+c.repo))
+}
+
+// get fetches a single page and decodes it into v. The returned int is the next
+// page, or 0 when this was the last page. Rate limited requests are retried up
+// to maxAttempts times, and a 404 is returned as forge.ErrNotFound.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) (int, error) {
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return 0, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path+"?"+query.Encode(), nil)
+		if err != nil {
+			return 0, err
+		}
+		if c.token != "" {
+			req.Header.Set("PRIVATE-TOKEN", c.token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			if attempt >= c.maxAttempts {
+				return 0, fmt.Errorf("rate limited %d times by %s", attempt, path)
+			}
+			wait := c.retryAfter
+			if seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After")); seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			log.Printf("API Rate limit exceeded. Sleeping for %v", wait)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, ctx.Err()
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return 0, fmt.Errorf("%s: %w", path, forge.ErrNotFound)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, path)
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(v)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		nextPage, _ := strconv.Atoi(resp.Header.Get("X-Next-Page"))
+		return nextPage, nil
+	}
+}
+
+func toUser(u *user) *github.User {
+	if u == nil {
+		return nil
+	}
+	return &github.User{
+		ID:      github.Int64(u.ID),
+		Login:   github.String(u.Username),
+		Name:    github.String(u.Name),
+		HTMLURL: github.String(u.WebURL),
+		Type:    github.String("User"),
+	}
+}
+
+func toPullRequest(mr *mergeRequest) *github.PullRequest {
+	mergedBy := mr.MergeUser
+	if mergedBy == nil {
+		mergedBy = mr.MergedBy
+	}
+	createdAt, updatedAt := mr.CreatedAt, mr.UpdatedAt
+	return &github.PullRequest{
+		ID:        github.Int64(mr.ID),
+		Number:    github.Int(mr.IID),
+		State:     github.String("closed"),
+		Title:     github.String(mr.Title),
+		Body:      github.String(mr.Description),
+		HTMLURL:   github.String(mr.WebURL),
+		User:      toUser(mr.Author),
+		MergedBy:  toUser(mergedBy),
+		Merged:    github.Bool(mr.MergedAt != nil),
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+		MergedAt:  mr.MergedAt,
+		ClosedAt:  mr.ClosedAt,
+		Head: &github.PullRequestBranch{
+			Ref: github.String(mr.SourceBranch),
+			SHA: github.String(mr.SHA),
+		},
+		Base: &github.PullRequestBranch{
+			Ref: github.String(mr.TargetBranch),
+		},
+	}
+}
+
+// ListMergedChangeRequests lists merged merge requests sorted by updated_at and
+// calls fn for the ones updated after since.
+func (c *Client) ListMergedChangeRequests(ctx context.Context, since time.Time, fn func(*forge.PullRequest) error) error {
+	page := 1
+	for page != 0 {
+		query := url.Values{}
+		query.Set("state", "merged")
+		query.Set("order_by", "updated_at")
+		query.Set("sort", "desc")
+		query.Set("updated_after", since.UTC().Format(time.RFC3339))
+		query.Set("per_page", "100")
+		query.Set("page", strconv.Itoa(page))
+
+		var mergeRequests []*mergeRequest
+		nextPage, err := c.get(ctx, c.projectPath()+"/merge_requests", query, &mergeRequests)
+		if err != nil {
+			log.Printf("Error listing merge requests: %v", err)
+			return fmt.Errorf("error listing merge requests: %w", err)
+		}
+
+		for _, mr := range mergeRequests {
+			if !mr.UpdatedAt.After(since) {
+				return nil
+			}
+			if err := fn(toPullRequest(mr)); err != nil {
+				return err
+			}
+		}
+		page = nextPage
+	}
+	return nil
+}
+
+// ListReviews derives reviews from the merge request. Approvals come from the
+// approvals API, requested changes from the reviewers API and discussion notes
+// are treated as comment reviews.
+func (c *Client) ListReviews(ctx context.Context, number int) ([]*forge.PullRequestReview, error) {
+	allReviews := []*forge.PullRequestReview{}
+	page := 1
+	for page != 0 {
+		query := url.Values{}
+		query.Set("sort", "asc")
+		query.Set("order_by", "created_at")
+		query.Set("per_page", "100")
+		query.Set("page", strconv.Itoa(page))
+
+		var notes []*note
+		nextPage, err := c.get(ctx, fmt.Sprintf("%s/merge_requests/%d/notes", c.projectPath(), number), query, &notes)
+		if err != nil {
+			log.Printf("Error listing notes: %v", err)
+			return nil, fmt.Errorf("error listing notes: %w", err)
+		}
+		for _, n := range notes {
+			if n.Author == nil || n.System {
+				continue
+			}
+			createdAt := n.CreatedAt
+			allReviews = append(allReviews, &forge.PullRequestReview{
+				ID:          github.Int64(n.ID),
+				User:        toUser(n.Author),
+				Body:        github.String(n.Body),
+				State:       github.String("COMMENTED"),
+				SubmittedAt: &createdAt,
+			})
+		}
+		page = nextPage
+	}
+
+	var approvalState approvals
+	if _, err := c.get(ctx, fmt.Sprintf("%s/merge_requests/%d/approvals", c.projectPath(), number), url.Values{}, &approvalState); err != nil {
+		log.Printf("Error listing approvals: %v", err)
+		return nil, fmt.Errorf("error listing approvals: %w", err)
+	}
+	for _, approval := range approvalState.ApprovedBy {
+		if approval.User == nil {
+			continue
+		}
+		approvedAt := approvalState.UpdatedAt
+		if approval.ApprovedAt != nil {
+			approvedAt = *approval.ApprovedAt
+		}
+		allReviews = append(allReviews, &forge.PullRequestReview{
+			User:        toUser(approval.User),
+			State:       github.String("APPROVED"),
+			SubmittedAt: &approvedAt,
+		})
+	}
+
+	var reviewers []*reviewer
+	if _, err := c.get(ctx, fmt.Sprintf("%s/merge_requests/%d/reviewers", c.projectPath(), number), url.Values{}, &reviewers); err != nil {
+		log.Printf("Error listing reviewers: %v", err)
+		return nil, fmt.Errorf("error listing reviewers: %w", err)
+	}
+	for _, r := range reviewers {
+		if r.User == nil || r.State != REVIEWER_STATE_REQUESTED_CHANGES {
+			continue
+		}
+		createdAt := r.CreatedAt
+		allReviews = append(allReviews, &forge.PullRequestReview{
+			User:        toUser(r.User),
+			State:       github.String("CHANGES_REQUESTED"),
+			SubmittedAt: &createdAt,
+		})
+	}
+
+	sort.SliceStable(allReviews, func(i, j int) bool {
+		return allReviews[i].GetSubmittedAt().Before(allReviews[j].GetSubmittedAt())
+	})
+
+	log.Printf("Downloaded merge request reviews for %d", number)
+	return allReviews, nil
+}
+
+// countDiffLines counts added and deleted lines in a unified diff without its
+// file headers, which is how GitLab returns per-file diffs.
+func countDiffLines(diff string) (int, int) {
+	additions, deletions := 0, 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return additions, deletions
+}
+
+// ListFiles returns the files changed by the merge request.
+func (c *Client) ListFiles(ctx context.Context, number int) ([]*forge.CommitFile, error) {
+	var changes struct {
+		Changes []*change `json:"changes"`
+	}
+	_, err := c.get(ctx, fmt.Sprintf("%s/merge_requests/%d/changes", c.projectPath(), number), url.Values{}, &changes)
+	if err != nil {
+		log.Printf("Error listing changes: %v", err)
+		return nil, fmt.Errorf("error listing changes: %w", err)
+	}
+
+	allFiles := []*forge.CommitFile{}
+	for _, ch := range changes.Changes {
+		additions, deletions := countDiffLines(ch.Diff)
+		status := "modified"
+		switch {
+		case ch.NewFile:
+			status = "added"
+		case ch.DeletedFile:
+			status = "removed"
+		case ch.RenamedFile:
+			status = "renamed"
+		}
+
+		file := &forge.CommitFile{
+			Filename:  github.String(ch.NewPath),
+			Status:    github.String(status),
+			Additions: github.Int(additions),
+			Deletions: github.Int(deletions),
+			Changes:   github.Int(additions + deletions),
+		}
+		if ch.RenamedFile {
+			file.PreviousFilename = github.String(ch.OldPath)
+		}
+		allFiles = append(allFiles, file)
+	}
+
+	log.Printf("Downloaded merge request files for %d", number)
+	return allFiles, nil
+}
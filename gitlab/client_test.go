@@ -0,0 +1,171 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// newTestClient returns a client of a server answering requests for the paths
+// of the o/r project with the matching response, and with a 404 otherwise.
+func newTestClient(t *testing.T, responses map[string]string) (*Client, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		path := strings.TrimPrefix(r.URL.Path, "/api/v4/projects/o/r")
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			path += "?page=" + page
+		}
+		body, ok := responses[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if next, ok := responses[path+"?page=2"]; ok && next != "" {
+			w.Header().Set("X-Next-Page", "2")
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "", "o", "r")
+	client.limiter = rate.NewLimiter(rate.Inf, 1)
+	client.maxAttempts = 3
+	client.retryAfter = time.Millisecond
+	return client, &requests
+}
+
+func Test_ListMergedChangeRequests(t *testing.T) {
+	assert := assert.New(t)
+	client, _ := newTestClient(t, map[string]string{
+		"/merge_requests": `[
+			{"id": 12, "iid": 2, "author": {"id": 1, "username": "alice"}, "merge_user": {"id": 2, "username": "bob"},
+			 "merged_by": {"id": 3, "username": "carol"}, "updated_at": "2022-01-03T00:00:00Z", "merged_at": "2022-01-03T00:00:00Z",
+			 "source_branch": "feature", "target_branch": "main", "sha": "abc"}
+		]`,
+		"/merge_requests?page=2": `[
+			{"id": 11, "iid": 1, "author": {"id": 2, "username": "bob"}, "merged_by": {"id": 3, "username": "carol"},
+			 "updated_at": "2022-01-02T00:00:00Z", "merged_at": "2022-01-02T00:00:00Z"},
+			{"id": 10, "iid": 0, "updated_at": "2021-12-31T00:00:00Z"}
+		]`,
+	})
+
+	pullRequests := []*forge.PullRequest{}
+	err := client.ListMergedChangeRequests(context.Background(), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), func(pr *forge.PullRequest) error {
+		pullRequests = append(pullRequests, pr)
+		return nil
+	})
+	assert.Nil(err)
+	assert.Len(pullRequests, 2)
+
+	assert.Equal(2, pullRequests[0].GetNumber())
+	assert.Equal("alice", pullRequests[0].GetUser().GetLogin())
+	assert.Equal("bob", pullRequests[0].GetMergedBy().GetLogin())
+	assert.True(pullRequests[0].GetMerged())
+	assert.Equal("feature", pullRequests[0].GetHead().GetRef())
+	assert.Equal("abc", pullRequests[0].GetHead().GetSHA())
+	assert.Equal("main", pullRequests[0].GetBase().GetRef())
+
+	assert.Equal(1, pullRequests[1].GetNumber())
+	assert.Equal("carol", pullRequests[1].GetMergedBy().GetLogin())
+}
+
+func Test_ListReviews(t *testing.T) {
+	assert := assert.New(t)
+	client, _ := newTestClient(t, map[string]string{
+		"/merge_requests/1/notes": `[
+			{"id": 1, "body": "approved this merge request", "author": {"id": 2, "username": "bob"}, "created_at": "2022-01-01T00:00:00Z", "system": true},
+			{"id": 2, "body": "Looks good", "author": {"id": 2, "username": "bob"}, "created_at": "2022-01-01T01:00:00Z"}
+		]`,
+		"/merge_requests/1/notes?page=2": `[
+			{"id": 3, "body": "Nit", "author": {"id": 3, "username": "carol"}, "created_at": "2022-01-01T02:00:00Z"}
+		]`,
+		"/merge_requests/1/approvals": `{
+			"updated_at": "2022-01-01T05:00:00Z",
+			"approved_by": [
+				{"user": {"id": 2, "username": "bob"}, "approved_at": "2022-01-01T03:00:00Z"},
+				{"user": {"id": 4, "username": "dave"}}
+			]
+		}`,
+		"/merge_requests/1/reviewers": `[
+			{"user": {"id": 3, "username": "carol"}, "state": "requested_changes", "created_at": "2022-01-01T04:00:00Z"},
+			{"user": {"id": 5, "username": "erin"}, "state": "unreviewed", "created_at": "2022-01-01T04:00:00Z"}
+		]`,
+	})
+
+	reviews, err := client.ListReviews(context.Background(), 1)
+	assert.Nil(err)
+
+	got := []string{}
+	for _, review := range reviews {
+		got = append(got, review.GetUser().GetLogin()+" "+review.GetState()+" "+review.GetSubmittedAt().Format("15:04"))
+	}
+	assert.Equal([]string{
+		"bob COMMENTED 01:00",
+		"carol COMMENTED 02:00",
+		"bob APPROVED 03:00",
+		"carol CHANGES_REQUESTED 04:00",
+		"dave APPROVED 05:00",
+	}, got)
+}
+
+func Test_ListFiles(t *testing.T) {
+	assert := assert.New(t)
+	client, _ := newTestClient(t, map[string]string{
+		"/merge_requests/1/changes": `{"changes": [
+			{"old_path": "a.go", "new_path": "a.go", "diff": "@@ -1,2 +1,2 @@\n-old\n+new\n+more\n context\n"},
+			{"old_path": "b.go", "new_path": "c.go", "renamed_file": true, "diff": ""},
+			{"old_path": "d.go", "new_path": "d.go", "deleted_file": true, "diff": "--- a/d.go\n+++ /dev/null\n-gone\n"}
+		]}`,
+	})
+
+	files, err := client.ListFiles(context.Background(), 1)
+	assert.Nil(err)
+	assert.Len(files, 3)
+	assert.Equal("modified", files[0].GetStatus())
+	assert.Equal(2, files[0].GetAdditions())
+	assert.Equal(1, files[0].GetDeletions())
+	assert.Equal("renamed", files[1].GetStatus())
+	assert.Equal("b.go", files[1].GetPreviousFilename())
+	assert.Equal("removed", files[2].GetStatus())
+	assert.Equal(0, files[2].GetAdditions())
+	assert.Equal(1, files[2].GetDeletions())
+}
+
+func Test_NotFound(t *testing.T) {
+	client, requests := newTestClient(t, map[string]string{})
+	_, err := client.ListFiles(context.Background(), 1)
+	assert.True(t, errors.Is(err, forge.ErrNotFound))
+	assert.Equal(t, 1, *requests)
+}
+
+func Test_GivesUpOnRateLimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "o", "r")
+	client.limiter = rate.NewLimiter(rate.Inf, 1)
+	client.maxAttempts = 3
+	client.retryAfter = time.Millisecond
+	_, err := client.ListFiles(context.Background(), 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests)
+
+	client.retryAfter = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.ListFiles(ctx, 1)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
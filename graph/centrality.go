@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+const (
+	METRIC_PAGERANK    = "pagerank"
+	METRIC_BETWEENNESS = "betweenness"
+	// METRIC_HUB is high for people who request reviews from many sought
+	// after reviewers.
+	METRIC_HUB = "hub"
+	// METRIC_AUTHORITY is high for people whose approvals everyone seeks.
+	METRIC_AUTHORITY   = "authority"
+	METRIC_IN_DEGREE   = "indegree"
+	METRIC_OUT_DEGREE  = "outdegree"
+	METRIC_RECIPROCITY = "reciprocity"
+)
+
+// Edges point from the author of a pull request to its reviewer, so the
+// weighted in-degree of a person is the weight of the reviews they gave and the
+// weighted out-degree the weight of the reviews they received.
+type centrality struct {
+	PageRank          float64
+	Betweenness       float64
+	Hub               float64
+	Authority         float64
+	WeightedInDegree  float64
+	WeightedOutDegree float64
+	// Reciprocity is the fraction of a person's review partners that both
+	// review them and are reviewed by them.
+	Reciprocity float64
+}
+
+// IsValidMetric reports whether metric is one of the METRIC_ constants.
+func IsValidMetric(metric string) bool {
+	switch metric {
+	case METRIC_PAGERANK, METRIC_BETWEENNESS, METRIC_HUB, METRIC_AUTHORITY, METRIC_IN_DEGREE, METRIC_OUT_DEGREE, METRIC_RECIPROCITY:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *centrality) get(metric string) float64 {
+	switch metric {
+	case METRIC_BETWEENNESS:
+		return c.Betweenness
+	case METRIC_HUB:
+		return c.Hub
+	case METRIC_AUTHORITY:
+		return c.Authority
+	case METRIC_IN_DEGREE:
+		return c.WeightedInDegree
+	case METRIC_OUT_DEGREE:
+		return c.WeightedOutDegree
+	case METRIC_RECIPROCITY:
+		return c.Reciprocity
+	default:
+		return c.PageRank
+	}
+}
+
+// metric returns the raw value of one of the METRIC_ constants, which unlike
+// the normalized Score can be compared between graphs.
+func (n Node) metric(metric string) float64 {
+	c := centrality{
+		PageRank:          n.PageRank,
+		Betweenness:       n.Betweenness,
+		Hub:               n.Hub,
+		Authority:         n.Authority,
+		WeightedInDegree:  n.WeightedInDegree,
+		WeightedOutDegree: n.WeightedOutDegree,
+		Reciprocity:       n.Reciprocity,
+	}
+	return c.get(metric)
+}
+
+func computeCentrality(g *simple.WeightedDirectedGraph, pageRank map[int64]float64, edgeWeight map[simple.Edge]float64) map[int64]*centrality {
+	centralities := map[int64]*centrality{}
+	for id, rank := range pageRank {
+		centralities[id] = &centrality{PageRank: rank}
+	}
+
+	for id, betweenness := range network.Betweenness(g) {
+		centralities[id].Betweenness = betweenness
+	}
+
+	for id, hubAuthority := range network.HITS(g, 0.00000001) {
+		centralities[id].Hub = hubAuthority.Hub
+		centralities[id].Authority = hubAuthority.Authority
+	}
+
+	partners := map[int64]map[int64]bool{}
+	for edge, weight := range edgeWeight {
+		from, to := edge.F.ID(), edge.T.ID()
+		centralities[from].WeightedOutDegree += weight
+		centralities[to].WeightedInDegree += weight
+
+		if from == to {
+			continue
+		}
+		for _, pair := range [][2]int64{{from, to}, {to, from}} {
+			if _, ok := partners[pair[0]]; !ok {
+				partners[pair[0]] = map[int64]bool{}
+			}
+			partners[pair[0]][pair[1]] = true
+		}
+	}
+
+	for id, ids := range partners {
+		reciprocated := 0
+		for partner := range ids {
+			if g.HasEdgeFromTo(id, partner) && g.HasEdgeFromTo(partner, id) {
+				reciprocated++
+			}
+		}
+		centralities[id].Reciprocity = float64(reciprocated) / float64(len(ids))
+	}
+
+	return centralities
+}
@@ -0,0 +1,50 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// newWeightedGraph returns a graph of the weighted edges along with their
+// weights keyed the way Build keys them.
+func newWeightedGraph(weights map[[2]int64]float64) (*simple.WeightedDirectedGraph, map[simple.Edge]float64) {
+	g := simple.NewWeightedDirectedGraph(0, 0)
+	edgeWeight := map[simple.Edge]float64{}
+	for ids, weight := range weights {
+		from, to := simple.Node(ids[0]), simple.Node(ids[1])
+		g.SetWeightedEdge(simple.WeightedEdge{F: from, T: to, W: weight})
+		edgeWeight[simple.Edge{F: from, T: to}] = weight
+	}
+	return g, edgeWeight
+}
+
+func Test_ComputeCentrality(t *testing.T) {
+	assert := assert.New(t)
+	// 1 and 2 review each other and 1's pull requests are also reviewed by 3.
+	g, edgeWeight := newWeightedGraph(map[[2]int64]float64{
+		{1, 2}: 2,
+		{2, 1}: 1,
+		{1, 3}: 3,
+	})
+
+	centralities := computeCentrality(g, network.PageRank(g, 0.85, 0.00000001), edgeWeight)
+	assert.Len(centralities, 3)
+
+	assert.Equal(5.0, centralities[1].WeightedOutDegree)
+	assert.Equal(1.0, centralities[1].WeightedInDegree)
+	assert.Equal(1.0, centralities[2].WeightedOutDegree)
+	assert.Equal(2.0, centralities[2].WeightedInDegree)
+	assert.Equal(0.0, centralities[3].WeightedOutDegree)
+	assert.Equal(3.0, centralities[3].WeightedInDegree)
+
+	assert.Equal(0.5, centralities[1].Reciprocity)
+	assert.Equal(1.0, centralities[2].Reciprocity)
+	assert.Equal(0.0, centralities[3].Reciprocity)
+
+	// 2 only reaches 3 through 1.
+	assert.Greater(centralities[1].Betweenness, 0.0)
+	assert.Equal(0.0, centralities[3].Betweenness)
+}
@@ -0,0 +1,50 @@
+package graph
+
+import (
+	"sort"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/graph/community"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+const (
+	// GROUP_BY_RANK buckets nodes by how many times their PageRank has to be
+	// doubled to reach the highest rank.
+	GROUP_BY_RANK = "rank"
+	// GROUP_BY_COMMUNITY groups nodes by the communities found by Louvain
+	// modularity optimization over the weighted approval graph.
+	GROUP_BY_COMMUNITY = "community"
+)
+
+// detectCommunities returns the communities of the graph ordered from the
+// largest to the smallest, along with the modularity of the partition. The
+// random source is seeded so the same data always yields the same groups.
+func detectCommunities(g *simple.WeightedDirectedGraph, resolution float64) ([][]int64, float64) {
+	if resolution == 0 {
+		resolution = 1
+	}
+
+	reduced := community.Modularize(g, resolution, rand.NewSource(1))
+	communities := reduced.Communities()
+	modularity := community.Q(g, communities, resolution)
+
+	communityIDs := make([][]int64, 0, len(communities))
+	for _, nodes := range communities {
+		ids := make([]int64, 0, len(nodes))
+		for _, node := range nodes {
+			ids = append(ids, node.ID())
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		communityIDs = append(communityIDs, ids)
+	}
+
+	sort.SliceStable(communityIDs, func(i, j int) bool {
+		if len(communityIDs[i]) != len(communityIDs[j]) {
+			return len(communityIDs[i]) > len(communityIDs[j])
+		}
+		return communityIDs[i][0] < communityIDs[j][0]
+	})
+
+	return communityIDs, modularity
+}
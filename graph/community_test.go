@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DetectCommunities(t *testing.T) {
+	assert := assert.New(t)
+	weights := map[[2]int64]float64{}
+	for _, group := range [][]int64{{1, 2, 3}, {4, 5, 6, 7}} {
+		for _, from := range group {
+			for _, to := range group {
+				if from != to {
+					weights[[2]int64{from, to}] = 10
+				}
+			}
+		}
+	}
+	weights[[2]int64{3, 4}] = 1
+	g, _ := newWeightedGraph(weights)
+
+	communities, modularity := detectCommunities(g, 0)
+	assert.Equal([][]int64{{4, 5, 6, 7}, {1, 2, 3}}, communities)
+	assert.Greater(modularity, 0.0)
+
+	again, _ := detectCommunities(g, 0)
+	assert.Equal(communities, again)
+
+	// A resolution low enough merges everyone into one community.
+	communities, _ = detectCommunities(g, 0.01)
+	assert.Equal([][]int64{{1, 2, 3, 4, 5, 6, 7}}, communities)
+}
@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"math"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+// decay is how much a review still counts given its age at end. Reviews lose
+// half their weight every halfLife, and nothing decays when halfLife is zero.
+func decay(pullDetail *forge.PullDetails, review *forge.PullRequestReview, end time.Time, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 1
+	}
+
+	reviewedAt := review.GetSubmittedAt()
+	if reviewedAt.IsZero() {
+		reviewedAt = pullDetail.PullRequest.GetCreatedAt()
+	}
+	age := end.Sub(reviewedAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
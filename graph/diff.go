@@ -0,0 +1,187 @@
+package graph
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// EdgeChange compares the review counts of an edge in Previous, Current and
+// Change, and its weights under the graph options in the Weight fields.
+// Changed edges are the ones whose weight changed.
+type EdgeChange struct {
+	Source         string  `json:"source"`
+	Target         string  `json:"target"`
+	Previous       int     `json:"previous"`
+	Current        int     `json:"current"`
+	Change         int     `json:"change"`
+	PreviousWeight float64 `json:"previousWeight"`
+	CurrentWeight  float64 `json:"currentWeight"`
+	WeightChange   float64 `json:"weightChange"`
+}
+
+// PageRankChange uses the raw PageRank rather than the normalized score, as
+// min-max normalization isn't comparable between two graphs.
+type PageRankChange struct {
+	ID       string  `json:"id"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"`
+}
+
+// GraphDiff compares the graph of the Current range against the graph of the
+// Previous range. Edges and people missing from one of the graphs count as
+// zero on that side.
+type GraphDiff struct {
+	Previous        TimeRange        `json:"previous"`
+	Current         TimeRange        `json:"current"`
+	AddedNodes      []string         `json:"addedNodes"`
+	RemovedNodes    []string         `json:"removedNodes"`
+	AddedEdges      []EdgeChange     `json:"addedEdges"`
+	RemovedEdges    []EdgeChange     `json:"removedEdges"`
+	ChangedEdges    []EdgeChange     `json:"changedEdges"`
+	PageRankChanges []PageRankChange `json:"pageRankChanges"`
+}
+
+// DiffGraphs builds a graph for each range and compares them.
+func DiffGraphs(pullDetails []*forge.PullDetails, previous, current TimeRange, opts Options) (*GraphDiff, error) {
+	previousOpts, currentOpts := opts, opts
+	previousOpts.End, currentOpts.End = previous.End, current.End
+
+	previousGraph, err := Build(FilterPullDetailsByTime(pullDetails, previous.Start, previous.End), previousOpts)
+	if err != nil {
+		return nil, err
+	}
+	currentGraph, err := Build(FilterPullDetailsByTime(pullDetails, current.Start, current.End), currentOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &GraphDiff{
+		Previous:        previous,
+		Current:         current,
+		AddedNodes:      []string{},
+		RemovedNodes:    []string{},
+		AddedEdges:      []EdgeChange{},
+		RemovedEdges:    []EdgeChange{},
+		ChangedEdges:    []EdgeChange{},
+		PageRankChanges: []PageRankChange{},
+	}
+
+	previousRanks, currentRanks := map[string]float64{}, map[string]float64{}
+	for _, node := range previousGraph.Nodes {
+		previousRanks[node.ID] = node.PageRank
+	}
+	for _, node := range currentGraph.Nodes {
+		currentRanks[node.ID] = node.PageRank
+		if _, ok := previousRanks[node.ID]; !ok {
+			diff.AddedNodes = append(diff.AddedNodes, node.ID)
+		}
+	}
+	for id := range previousRanks {
+		if _, ok := currentRanks[id]; !ok {
+			diff.RemovedNodes = append(diff.RemovedNodes, id)
+		}
+	}
+	sort.Strings(diff.AddedNodes)
+	sort.Strings(diff.RemovedNodes)
+
+	for id := range mergeKeys(previousRanks, currentRanks) {
+		change := currentRanks[id] - previousRanks[id]
+		if change == 0 {
+			continue
+		}
+		diff.PageRankChanges = append(diff.PageRankChanges, PageRankChange{
+			ID:       id,
+			Previous: previousRanks[id],
+			Current:  currentRanks[id],
+			Change:   change,
+		})
+	}
+	sort.Slice(diff.PageRankChanges, func(i, j int) bool {
+		a, b := math.Abs(diff.PageRankChanges[i].Change), math.Abs(diff.PageRankChanges[j].Change)
+		if a != b {
+			return a > b
+		}
+		return diff.PageRankChanges[i].ID < diff.PageRankChanges[j].ID
+	})
+
+	previousEdges, currentEdges := map[[2]string]Edge{}, map[[2]string]Edge{}
+	for _, link := range previousGraph.Edges {
+		previousEdges[[2]string{link.Source, link.Target}] = link
+	}
+	for _, link := range currentGraph.Edges {
+		currentEdges[[2]string{link.Source, link.Target}] = link
+	}
+	for key := range mergeEdgeKeys(previousEdges, currentEdges) {
+		previousEdge, inPrevious := previousEdges[key]
+		currentEdge, inCurrent := currentEdges[key]
+		change := EdgeChange{
+			Source:         key[0],
+			Target:         key[1],
+			Previous:       previousEdge.Value,
+			Current:        currentEdge.Value,
+			Change:         currentEdge.Value - previousEdge.Value,
+			PreviousWeight: previousEdge.Weight,
+			CurrentWeight:  currentEdge.Weight,
+			WeightChange:   currentEdge.Weight - previousEdge.Weight,
+		}
+		switch {
+		case !inPrevious:
+			diff.AddedEdges = append(diff.AddedEdges, change)
+		case !inCurrent:
+			diff.RemovedEdges = append(diff.RemovedEdges, change)
+		case change.WeightChange != 0:
+			diff.ChangedEdges = append(diff.ChangedEdges, change)
+		}
+	}
+	for _, edges := range [][]EdgeChange{diff.AddedEdges, diff.RemovedEdges, diff.ChangedEdges} {
+		sortEdgeChanges(edges)
+	}
+
+	return diff, nil
+}
+
+func mergeKeys(a, b map[string]float64) map[string]bool {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+func mergeEdgeKeys(a, b map[[2]string]Edge) map[[2]string]bool {
+	keys := map[[2]string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+// sortEdgeChanges orders edges from the largest change in weight to the
+// smallest.
+func sortEdgeChanges(edges []EdgeChange) {
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := math.Abs(edges[i].WeightChange), math.Abs(edges[j].WeightChange)
+		if a != b {
+			return a > b
+		}
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+}
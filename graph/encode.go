@@ -0,0 +1,344 @@
+package graph
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FORMAT_JSON is the react-force-graph schema the web UI reads.
+	FORMAT_JSON      = "json"
+	FORMAT_GRAPHML   = "graphml"
+	FORMAT_GEXF      = "gexf"
+	FORMAT_DOT       = "dot"
+	FORMAT_NODES_CSV = "nodes.csv"
+	FORMAT_EDGES_CSV = "edges.csv"
+)
+
+type encoder interface {
+	contentType() string
+	encode(w io.Writer, g *ReviewGraph) error
+}
+
+var encoders = map[string]encoder{
+	FORMAT_JSON:      jsonEncoder{},
+	FORMAT_GRAPHML:   graphMLEncoder{},
+	FORMAT_GEXF:      gexfEncoder{},
+	FORMAT_DOT:       dotEncoder{},
+	FORMAT_NODES_CSV: nodesCSVEncoder{},
+	FORMAT_EDGES_CSV: edgesCSVEncoder{},
+}
+
+// ContentType returns the Content-Type of a format, and false when the format
+// is unknown.
+func ContentType(format string) (string, bool) {
+	e, ok := encoders[format]
+	if !ok {
+		return "", false
+	}
+	return e.contentType(), true
+}
+
+// Encode writes the graph to w in the given format.
+func Encode(w io.Writer, reviewGraph *ReviewGraph, format string) error {
+	e, ok := encoders[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return e.encode(w, reviewGraph)
+}
+
+// nodeAttribute is a numeric node attribute shared by the tabular and XML
+// formats.
+type nodeAttribute struct {
+	name  string
+	value func(node *Node) float64
+}
+
+var nodeAttributes = []nodeAttribute{
+	{"score", func(node *Node) float64 { return node.Score }},
+	{"pageRank", func(node *Node) float64 { return node.PageRank }},
+	{"betweenness", func(node *Node) float64 { return node.Betweenness }},
+	{"hub", func(node *Node) float64 { return node.Hub }},
+	{"authority", func(node *Node) float64 { return node.Authority }},
+	{"weightedInDegree", func(node *Node) float64 { return node.WeightedInDegree }},
+	{"weightedOutDegree", func(node *Node) float64 { return node.WeightedOutDegree }},
+	{"reciprocity", func(node *Node) float64 { return node.Reciprocity }},
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) contentType() string { return "application/json" }
+
+func (jsonEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	return json.NewEncoder(w).Encode(newForceGraph(g))
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLEncoder struct{}
+
+func (graphMLEncoder) contentType() string { return "application/graphml+xml" }
+
+func (graphMLEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	doc := graphMLDocument{Xmlns: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Graph.EdgeDefault = "directed"
+
+	for _, attribute := range nodeAttributes {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: attribute.name, For: "node", AttrName: attribute.name, AttrType: "double"})
+	}
+	doc.Keys = append(doc.Keys,
+		graphMLKey{ID: "group", For: "node", AttrName: "group", AttrType: "string"},
+		graphMLKey{ID: "weight", For: "edge", AttrName: "weight", AttrType: "double"},
+		graphMLKey{ID: "reviews", For: "edge", AttrName: "reviews", AttrType: "int"},
+		graphMLKey{ID: "medianLatencyHours", For: "edge", AttrName: "medianLatencyHours", AttrType: "double"},
+		graphMLKey{ID: "repos", For: "edge", AttrName: "repos", AttrType: "string"},
+	)
+
+	nodes, links := g.Nodes, g.Edges
+	for i := range nodes {
+		node := graphMLNode{ID: nodes[i].ID}
+		for _, attribute := range nodeAttributes {
+			node.Data = append(node.Data, graphMLData{Key: attribute.name, Value: formatFloat(attribute.value(&nodes[i]))})
+		}
+		node.Data = append(node.Data, graphMLData{Key: "group", Value: nodes[i].Group})
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, link := range links {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: link.Source,
+			Target: link.Target,
+			Data: []graphMLData{
+				{Key: "weight", Value: formatFloat(link.Weight)},
+				{Key: "reviews", Value: strconv.Itoa(link.Value)},
+				{Key: "medianLatencyHours", Value: formatFloat(link.MedianLatencyHours)},
+				{Key: "repos", Value: strings.Join(link.Repos, ",")},
+			},
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string  `xml:"id,attr"`
+	Source string  `xml:"source,attr"`
+	Target string  `xml:"target,attr"`
+	Weight float64 `xml:"weight,attr"`
+}
+
+type gexfDocument struct {
+	XMLName xml.Name `xml:"gexf"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		DefaultEdgeType string `xml:"defaultedgetype,attr"`
+		Attributes      struct {
+			Class      string          `xml:"class,attr"`
+			Attributes []gexfAttribute `xml:"attribute"`
+		} `xml:"attributes"`
+		Nodes []gexfNode `xml:"nodes>node"`
+		Edges []gexfEdge `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+type gexfEncoder struct{}
+
+func (gexfEncoder) contentType() string { return "application/gexf+xml" }
+
+func (gexfEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	// Readers such as NetworkX look elements up by namespace, so it has to be
+	// exactly the one of GEXF 1.2.
+	doc := gexfDocument{Xmlns: "http://www.gexf.net/1.2draft", Version: "1.2"}
+	doc.Graph.DefaultEdgeType = "directed"
+	doc.Graph.Attributes.Class = "node"
+
+	for _, attribute := range nodeAttributes {
+		doc.Graph.Attributes.Attributes = append(doc.Graph.Attributes.Attributes, gexfAttribute{ID: attribute.name, Title: attribute.name, Type: "double"})
+	}
+	doc.Graph.Attributes.Attributes = append(doc.Graph.Attributes.Attributes, gexfAttribute{ID: "group", Title: "group", Type: "string"})
+
+	nodes, links := g.Nodes, g.Edges
+	for i := range nodes {
+		node := gexfNode{ID: nodes[i].ID, Label: nodes[i].ID}
+		for _, attribute := range nodeAttributes {
+			node.AttValues = append(node.AttValues, gexfAttValue{For: attribute.name, Value: formatFloat(attribute.value(&nodes[i]))})
+		}
+		node.AttValues = append(node.AttValues, gexfAttValue{For: "group", Value: nodes[i].Group})
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i, link := range links {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     strconv.Itoa(i),
+			Source: link.Source,
+			Target: link.Target,
+			Weight: link.Weight,
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	xmlEncoder := xml.NewEncoder(w)
+	xmlEncoder.Indent("", "  ")
+	if err := xmlEncoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type dotEncoder struct{}
+
+func (dotEncoder) contentType() string { return "text/vnd.graphviz" }
+
+// dotID quotes an identifier so logins with dashes or brackets are valid.
+func dotID(id string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(id) + `"`
+}
+
+func (dotEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph reviews {\n")
+
+	nodes, links := g.Nodes, g.Edges
+	for i := range nodes {
+		attributes := []string{}
+		for _, attribute := range nodeAttributes {
+			attributes = append(attributes, fmt.Sprintf("%s=%s", attribute.name, formatFloat(attribute.value(&nodes[i]))))
+		}
+		attributes = append(attributes, fmt.Sprintf("group=%s", dotID(nodes[i].Group)))
+		fmt.Fprintf(&b, "  %s [%s];\n", dotID(nodes[i].ID), strings.Join(attributes, ", "))
+	}
+	for _, link := range links {
+		fmt.Fprintf(&b, "  %s -> %s [weight=%s, reviews=%d, medianLatencyHours=%s];\n", dotID(link.Source), dotID(link.Target), formatFloat(link.Weight), link.Value, formatFloat(link.MedianLatencyHours))
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type nodesCSVEncoder struct{}
+
+func (nodesCSVEncoder) contentType() string { return "text/csv" }
+
+func (nodesCSVEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	csvWriter := csv.NewWriter(w)
+
+	header := []string{"id"}
+	for _, attribute := range nodeAttributes {
+		header = append(header, attribute.name)
+	}
+	header = append(header, "group", "repos")
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	nodes := g.Nodes
+	for i := range nodes {
+		record := []string{nodes[i].ID}
+		for _, attribute := range nodeAttributes {
+			record = append(record, formatFloat(attribute.value(&nodes[i])))
+		}
+		record = append(record, nodes[i].Group, strings.Join(nodes[i].Repos, ","))
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+type edgesCSVEncoder struct{}
+
+func (edgesCSVEncoder) contentType() string { return "text/csv" }
+
+func (edgesCSVEncoder) encode(w io.Writer, g *ReviewGraph) error {
+	csvWriter := csv.NewWriter(w)
+	header := []string{"source", "target", "weight", "reviews"}
+	for _, state := range REVIEW_STATES {
+		header = append(header, strings.ToLower(state))
+	}
+	header = append(header, "medianLatencyHours", "repos")
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	for _, link := range g.Edges {
+		record := []string{link.Source, link.Target, formatFloat(link.Weight), strconv.Itoa(link.Value)}
+		for _, state := range REVIEW_STATES {
+			record = append(record, strconv.Itoa(link.States[state]))
+		}
+		record = append(record, formatFloat(link.MedianLatencyHours), strings.Join(link.Repos, ","))
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
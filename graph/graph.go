@@ -0,0 +1,459 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/identity"
+	"github.com/mentallyanimated/reporeportcard-core/latency"
+	"github.com/mentallyanimated/reporeportcard-core/team"
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+const (
+	// LEVEL_PERSON builds a node per person.
+	LEVEL_PERSON = "person"
+	// LEVEL_TEAM collapses everyone into their team, so edges are reviews
+	// between teams. Reviews within a team don't show up as edges but are
+	// counted in the team matrix.
+	LEVEL_TEAM = "team"
+)
+
+// Options control how the graph is built.
+type Options struct {
+	// Group is either GROUP_BY_RANK or GROUP_BY_COMMUNITY. It defaults to
+	// GROUP_BY_RANK.
+	Group string
+	// Resolution is the Louvain resolution parameter used when grouping by
+	// community. Higher values find smaller communities. It defaults to 1.
+	Resolution float64
+	// Metric is the node metric used as the score, one of the METRIC_
+	// constants. It defaults to METRIC_PAGERANK.
+	Metric string
+	// StateWeights maps the review states that contribute edges to how much
+	// each review of that state weighs. It defaults to DefaultStateWeights.
+	StateWeights map[string]float64
+	// Weighting is how reviews are weighed by the size of the pull request,
+	// one of the WEIGHTING_ constants. It defaults to WEIGHTING_COUNT.
+	Weighting string
+	// HalfLife decays each review's weight by its age relative to End, halving
+	// it every HalfLife. Reviews don't decay when it's zero.
+	HalfLife time.Duration
+	// End is the end of the analysis window. It defaults to the most recent
+	// review.
+	End time.Time
+	// Exclude leaves accounts such as bots out of the graph. Nothing is
+	// excluded when it's nil.
+	Exclude *filter.Rules
+	// Identities collapses the accounts of people with several of them and
+	// names nodes after them. Accounts are used as is when it's nil.
+	Identities *identity.Mapping
+	// Level is LEVEL_PERSON or LEVEL_TEAM. It defaults to LEVEL_PERSON.
+	Level string
+	// Teams assigns people to teams. LEVEL_TEAM needs either Teams or
+	// Identities whose people have a Team, which also covers anyone missing
+	// from Teams.
+	Teams *team.Membership
+}
+
+// Edge points from the author of pull requests to someone who reviewed them.
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Value is the number of reviews that contributed to the edge.
+	Value int `json:"value"`
+	// Weight is the sum of the weights of those reviews, each being its state
+	// weight times the effort given by Options.Weighting, decayed by its age
+	// when Options.HalfLife is set.
+	Weight float64 `json:"weight"`
+	// States counts the reviews of each state.
+	States map[string]int `json:"states"`
+	Repos  []string       `json:"repos"`
+	// MedianLatencyHours is the median time from the source opening a pull
+	// request to the target reviewing it.
+	MedianLatencyHours float64 `json:"medianLatencyHours"`
+}
+
+// Node carries every node metric. Score is the metric selected by
+// Options.Metric, min-max normalized to the range [0, 10].
+type Node struct {
+	ID                string   `json:"id"`
+	Score             float64  `json:"score"`
+	PageRank          float64  `json:"pageRank"`
+	Betweenness       float64  `json:"betweenness"`
+	Hub               float64  `json:"hub"`
+	Authority         float64  `json:"authority"`
+	WeightedInDegree  float64  `json:"weightedInDegree"`
+	WeightedOutDegree float64  `json:"weightedOutDegree"`
+	Reciprocity       float64  `json:"reciprocity"`
+	Group             string   `json:"group"`
+	Repos             []string `json:"repos"`
+	// Name and Team come from Options.Identities.
+	Name string `json:"name,omitempty"`
+	Team string `json:"team,omitempty"`
+}
+
+// Metadata describes what a graph was built from.
+type Metadata struct {
+	PullRequests int                `json:"pullRequests"`
+	Reviews      int                `json:"reviews"`
+	Group        string             `json:"group"`
+	Metric       string             `json:"metric"`
+	StateWeights map[string]float64 `json:"stateWeights"`
+	Weighting    string             `json:"weighting"`
+	// HalfLifeHours is zero when reviews don't decay.
+	HalfLifeHours float64   `json:"halfLifeHours"`
+	End           time.Time `json:"end"`
+	// Excluded is only set when Options.Exclude is.
+	Excluded *filter.Excluded `json:"excluded,omitempty"`
+	Level    string           `json:"level"`
+}
+
+// ReviewGraph is the computed review graph. Nodes are ordered by ID and
+// edges by source then target.
+type ReviewGraph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// Modularity and Communities are only set when grouping by community.
+	// Each node's group is the 1-based index of its community.
+	Modularity  float64    `json:"modularity,omitempty"`
+	Communities [][]string `json:"communities,omitempty"`
+	// TeamMatrix is only set at LEVEL_TEAM.
+	TeamMatrix *team.Matrix `json:"teamMatrix,omitempty"`
+	Metadata   Metadata     `json:"metadata"`
+}
+
+func validateOptions(opts *Options) error {
+	switch opts.Group {
+	case "":
+		opts.Group = GROUP_BY_RANK
+	case GROUP_BY_RANK, GROUP_BY_COMMUNITY:
+	default:
+		return fmt.Errorf("unknown group %q", opts.Group)
+	}
+
+	if opts.Metric == "" {
+		opts.Metric = METRIC_PAGERANK
+	} else if !IsValidMetric(opts.Metric) {
+		return fmt.Errorf("unknown metric %q", opts.Metric)
+	}
+
+	if opts.Weighting == "" {
+		opts.Weighting = WEIGHTING_COUNT
+	} else if !IsValidWeighting(opts.Weighting) {
+		return fmt.Errorf("unknown weighting %q", opts.Weighting)
+	}
+
+	switch opts.Level {
+	case "":
+		opts.Level = LEVEL_PERSON
+	case LEVEL_PERSON:
+	case LEVEL_TEAM:
+		if opts.Teams = levelTeams(*opts); opts.Teams == nil {
+			return errors.New("team level graphs need teams or identities with teams")
+		}
+	default:
+		return fmt.Errorf("unknown level %q", opts.Level)
+	}
+
+	if opts.HalfLife < 0 {
+		return errors.New("half-life can't be negative")
+	}
+
+	if opts.StateWeights == nil {
+		opts.StateWeights = DefaultStateWeights()
+	}
+	for state, weight := range opts.StateWeights {
+		if !isReviewState(state) {
+			return fmt.Errorf("unknown review state %q", state)
+		}
+		if weight < 0 {
+			return fmt.Errorf("negative weight for %s", state)
+		}
+	}
+	return nil
+}
+
+// Build computes the review graph of the pull requests along with the metrics
+// of every person in it. Excluded accounts are dropped and the remaining ones
+// collapsed into people before any edge is counted. Only reviews whose state
+// has a weight in Options.StateWeights contribute edges.
+func Build(pullDetails []*forge.PullDetails, opts Options) (*ReviewGraph, error) {
+	if err := validateOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	var excluded *filter.Excluded
+	if opts.Exclude != nil {
+		var err error
+		if pullDetails, excluded, err = filter.Apply(pullDetails, opts.Exclude); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Identities != nil {
+		pullDetails = opts.Identities.Apply(pullDetails)
+	}
+	var teamMatrix *team.Matrix
+	if opts.Level == LEVEL_TEAM {
+		teamMatrix = opts.Teams.BuildMatrix(pullDetails, opts.StateWeights)
+		pullDetails = opts.Teams.Apply(pullDetails)
+	}
+	if opts.End.IsZero() {
+		opts.End = latestReview(pullDetails)
+	}
+
+	userIDToLogin := map[int64]string{}
+	edgeFrequency := map[simple.Edge]int{}
+	edgeWeight := map[simple.Edge]float64{}
+	edgeStates := map[simple.Edge]map[string]int{}
+	edgeRepos := map[simple.Edge]map[string]bool{}
+	edgeLatencies := map[simple.Edge][]float64{}
+	nodeRepos := map[int64]map[string]bool{}
+	totalReviewCount := 0
+	totalWeight := 0.0
+
+	for _, pullDetail := range pullDetails {
+		requestorID := pullDetail.PullRequest.GetUser().GetID()
+		requestorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+		effort := reviewEffort(pullDetail, opts.Weighting)
+
+		for _, review := range pullDetail.Reviews {
+			weight := opts.StateWeights[review.GetState()] * effort * decay(pullDetail, review, opts.End, opts.HalfLife)
+			if weight == 0 {
+				continue
+			}
+			reviewerID := review.GetUser().GetID()
+			reviewerLogin := review.GetUser().GetLogin()
+
+			if requestorLogin == "" || reviewerLogin == "" {
+				continue
+			}
+
+			if requestorLogin == "ghost" || reviewerLogin == "ghost" {
+				continue
+			}
+
+			// Reviewing yourself, such as from another account of the same
+			// person, says nothing about collaboration and gonum can't add
+			// self edges.
+			if requestorID == reviewerID {
+				continue
+			}
+
+			userIDToLogin[requestorID] = requestorLogin
+			userIDToLogin[reviewerID] = reviewerLogin
+
+			edge := simple.Edge{
+				F: simple.Node(requestorID),
+				T: simple.Node(reviewerID),
+			}
+
+			if _, ok := edgeFrequency[edge]; ok {
+				edgeFrequency[edge]++
+			} else {
+				edgeFrequency[edge] = 1
+				edgeStates[edge] = map[string]int{}
+				edgeRepos[edge] = map[string]bool{}
+			}
+			edgeWeight[edge] += weight
+			edgeStates[edge][review.GetState()]++
+			edgeRepos[edge][pullDetail.Repo] = true
+
+			createdAt, submittedAt := pullDetail.PullRequest.GetCreatedAt(), review.GetSubmittedAt()
+			if !createdAt.IsZero() && !submittedAt.IsZero() {
+				edgeLatencies[edge] = append(edgeLatencies[edge], submittedAt.Sub(createdAt).Hours())
+			}
+
+			for _, id := range []int64{requestorID, reviewerID} {
+				if _, ok := nodeRepos[id]; !ok {
+					nodeRepos[id] = map[string]bool{}
+				}
+				nodeRepos[id][pullDetail.Repo] = true
+			}
+
+			totalReviewCount++
+			totalWeight += weight
+		}
+	}
+
+	reviewGraph := &ReviewGraph{
+		Nodes:      []Node{},
+		Edges:      []Edge{},
+		TeamMatrix: teamMatrix,
+		Metadata: Metadata{
+			PullRequests:  len(pullDetails),
+			Reviews:       totalReviewCount,
+			Group:         opts.Group,
+			Metric:        opts.Metric,
+			StateWeights:  opts.StateWeights,
+			Weighting:     opts.Weighting,
+			HalfLifeHours: opts.HalfLife.Hours(),
+			End:           opts.End,
+			Excluded:      excluded,
+			Level:         opts.Level,
+		},
+	}
+
+	if len(edgeFrequency) == 0 {
+		// PageRank panics on an empty graph, which happens whenever nothing in
+		// the range was reviewed.
+		return reviewGraph, nil
+	}
+
+	graph := simple.NewWeightedDirectedGraph(0, 0)
+
+	for edge, weight := range edgeWeight {
+		graph.SetWeightedEdge(simple.WeightedEdge{
+			F: edge.F,
+			T: edge.T,
+			W: (weight / totalWeight) * 100,
+		})
+	}
+
+	pageRank := network.PageRank(graph, 0.85, 0.00000001)
+	centralities := computeCentrality(graph, pageRank, edgeWeight)
+	var maxRankScore, minScore, maxScore float64
+
+	nodeToCommunity := map[int64]int{}
+	if opts.Group == GROUP_BY_COMMUNITY {
+		var communityIDs [][]int64
+		communityIDs, reviewGraph.Modularity = detectCommunities(graph, opts.Resolution)
+		for i, ids := range communityIDs {
+			logins := []string{}
+			for _, id := range ids {
+				nodeToCommunity[id] = i + 1
+				logins = append(logins, userIDToLogin[id])
+			}
+			reviewGraph.Communities = append(reviewGraph.Communities, logins)
+		}
+	}
+
+	for _, rank := range pageRank {
+		if rank > maxRankScore {
+			maxRankScore = rank
+		}
+	}
+
+	first := true
+	for _, c := range centralities {
+		score := c.get(opts.Metric)
+		if first || score < minScore {
+			minScore = score
+		}
+		if first || score > maxScore {
+			maxScore = score
+		}
+		first = false
+	}
+
+	for id, rank := range pageRank {
+		adjustedScore := 0.0
+		if maxScore > minScore {
+			adjustedScore = 10 * ((centralities[id].get(opts.Metric) - minScore) / (maxScore - minScore))
+		}
+
+		group := 1
+		if opts.Group == GROUP_BY_COMMUNITY {
+			group = nodeToCommunity[id]
+		} else {
+			for rank < maxRankScore {
+				rank *= 2
+				group++
+			}
+		}
+
+		reviewGraph.Nodes = append(reviewGraph.Nodes, Node{
+			ID:                userIDToLogin[id],
+			Score:             adjustedScore,
+			PageRank:          centralities[id].PageRank,
+			Betweenness:       centralities[id].Betweenness,
+			Hub:               centralities[id].Hub,
+			Authority:         centralities[id].Authority,
+			WeightedInDegree:  centralities[id].WeightedInDegree,
+			WeightedOutDegree: centralities[id].WeightedOutDegree,
+			Reciprocity:       centralities[id].Reciprocity,
+			Group:             fmt.Sprintf("%d", group),
+			Repos:             sortedKeys(nodeRepos[id]),
+		})
+	}
+
+	for edge, frequency := range edgeFrequency {
+		reviewGraph.Edges = append(reviewGraph.Edges, Edge{
+			Source:             userIDToLogin[edge.F.ID()],
+			Target:             userIDToLogin[edge.T.ID()],
+			Value:              frequency,
+			Weight:             edgeWeight[edge],
+			States:             edgeStates[edge],
+			Repos:              sortedKeys(edgeRepos[edge]),
+			MedianLatencyHours: latency.Percentile(edgeLatencies[edge], 50),
+		})
+	}
+
+	if opts.Identities != nil {
+		for i := range reviewGraph.Nodes {
+			if person, ok := opts.Identities.PersonByLogin(reviewGraph.Nodes[i].ID); ok {
+				reviewGraph.Nodes[i].Name = person.Name
+				reviewGraph.Nodes[i].Team = person.Team
+			}
+		}
+	}
+
+	sort.Slice(reviewGraph.Nodes, func(i, j int) bool {
+		return reviewGraph.Nodes[i].ID < reviewGraph.Nodes[j].ID
+	})
+	sort.Slice(reviewGraph.Edges, func(i, j int) bool {
+		if reviewGraph.Edges[i].Source != reviewGraph.Edges[j].Source {
+			return reviewGraph.Edges[i].Source < reviewGraph.Edges[j].Source
+		}
+		return reviewGraph.Edges[i].Target < reviewGraph.Edges[j].Target
+	})
+
+	return reviewGraph, nil
+}
+
+// levelTeams returns the teams of a team level graph. People missing from
+// Options.Teams fall back to their Person.Team in Options.Identities, which is
+// also used on its own when there are no teams.
+func levelTeams(opts Options) *team.Membership {
+	var identityTeams map[string][]string
+	if opts.Identities != nil {
+		identityTeams = opts.Identities.Teams()
+	}
+
+	switch {
+	case opts.Teams != nil && len(identityTeams) > 0:
+		return opts.Teams.WithFallback(identityTeams)
+	case opts.Teams != nil:
+		return opts.Teams
+	case len(identityTeams) > 0:
+		return team.New(identityTeams)
+	default:
+		return nil
+	}
+}
+
+func latestReview(pullDetails []*forge.PullDetails) time.Time {
+	var latest time.Time
+	for _, pullDetail := range pullDetails {
+		for _, review := range pullDetail.Reviews {
+			if submittedAt := review.GetSubmittedAt(); submittedAt.After(latest) {
+				latest = submittedAt
+			}
+		}
+	}
+	return latest
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
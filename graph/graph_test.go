@@ -0,0 +1,322 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BuildInvalidOptions(t *testing.T) {
+	_, err := Build(nil, Options{Metric: "bogus"})
+	assert.Error(t, err)
+
+	_, err = Build(nil, Options{Group: "bogus"})
+	assert.Error(t, err)
+
+	_, err = Build(nil, Options{Weighting: "bogus"})
+	assert.Error(t, err)
+
+	_, err = Build(nil, Options{Level: LEVEL_TEAM})
+	assert.Error(t, err)
+}
+
+func Test_BuildWithoutApprovals(t *testing.T) {
+	pullDetails := []*forge.PullDetails{{
+		PullRequest: &forge.PullRequest{User: &forge.User{Login: gogithub.String("alice")}},
+		Reviews: []*forge.PullRequestReview{{
+			User:  &forge.User{Login: gogithub.String("bob")},
+			State: gogithub.String("COMMENTED"),
+		}},
+	}}
+
+	reviewGraph, err := Build(pullDetails, Options{})
+	assert.Nil(t, err)
+	assert.Empty(t, reviewGraph.Nodes)
+	assert.Empty(t, reviewGraph.Edges)
+	assert.Equal(t, Metadata{
+		PullRequests: 1,
+		Group:        GROUP_BY_RANK,
+		Metric:       METRIC_PAGERANK,
+		StateWeights: DefaultStateWeights(),
+		Weighting:    WEIGHTING_COUNT,
+		Level:        LEVEL_PERSON,
+	}, reviewGraph.Metadata)
+}
+
+func newUser(id int64, login string) *forge.User {
+	return &forge.User{ID: gogithub.Int64(id), Login: gogithub.String(login)}
+}
+
+func newReview(user *forge.User, state string, submittedAt time.Time) *forge.PullRequestReview {
+	return &forge.PullRequestReview{User: user, State: gogithub.String(state), SubmittedAt: &submittedAt}
+}
+
+// reviewPullDetails has alice and bob reviewing each other and carol only
+// commenting on alice's pull request.
+func reviewPullDetails() []*forge.PullDetails {
+	alice, bob, carol := newUser(1, "alice"), newUser(2, "bob"), newUser(3, "carol")
+	createdAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	return []*forge.PullDetails{
+		{
+			Repo:        "o/a",
+			PullRequest: &forge.PullRequest{User: alice, CreatedAt: &createdAt},
+			Reviews: []*forge.PullRequestReview{
+				newReview(bob, STATE_APPROVED, createdAt.Add(2*time.Hour)),
+				newReview(carol, STATE_COMMENTED, createdAt.Add(6*time.Hour)),
+			},
+		},
+		{
+			Repo:        "o/b",
+			PullRequest: &forge.PullRequest{User: bob, CreatedAt: &createdAt},
+			Reviews: []*forge.PullRequestReview{
+				newReview(alice, STATE_CHANGES_REQUESTED, createdAt.Add(time.Hour)),
+				newReview(alice, STATE_APPROVED, createdAt.Add(4*time.Hour)),
+			},
+		},
+		{
+			Repo:        "o/a",
+			PullRequest: &forge.PullRequest{User: bob, CreatedAt: &createdAt},
+			Reviews:     []*forge.PullRequestReview{newReview(alice, STATE_APPROVED, createdAt.Add(8*time.Hour))},
+		},
+	}
+}
+
+func Test_Build(t *testing.T) {
+	reviewGraph, err := Build(reviewPullDetails(), Options{
+		StateWeights: map[string]float64{STATE_APPROVED: 1, STATE_COMMENTED: 0.5},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Edge{
+		{Source: "alice", Target: "bob", Value: 1, Weight: 1, States: map[string]int{STATE_APPROVED: 1}, Repos: []string{"o/a"}, MedianLatencyHours: 2},
+		{Source: "alice", Target: "carol", Value: 1, Weight: 0.5, States: map[string]int{STATE_COMMENTED: 1}, Repos: []string{"o/a"}, MedianLatencyHours: 6},
+		{Source: "bob", Target: "alice", Value: 2, Weight: 2, States: map[string]int{STATE_APPROVED: 2}, Repos: []string{"o/a", "o/b"}, MedianLatencyHours: 6},
+	}, reviewGraph.Edges)
+	assert.Equal(t, 4, reviewGraph.Metadata.Reviews)
+
+	ids := []string{}
+	maxScore := 0.0
+	for _, node := range reviewGraph.Nodes {
+		ids = append(ids, node.ID)
+		if node.Score > maxScore {
+			maxScore = node.Score
+		}
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol"}, ids)
+	assert.Equal(t, 10.0, maxScore)
+
+	// alice is reviewed the most, so has the highest PageRank and is in
+	// the first group.
+	alice := reviewGraph.Nodes[0]
+	assert.Equal(t, "1", alice.Group)
+	assert.Equal(t, 10.0, alice.Score)
+	assert.Equal(t, []string{"o/a", "o/b"}, alice.Repos)
+	assert.Equal(t, 2.0, alice.WeightedInDegree)
+	assert.Equal(t, 1.5, alice.WeightedOutDegree)
+	for _, node := range reviewGraph.Nodes[1:] {
+		assert.Less(t, node.PageRank, alice.PageRank)
+		assert.NotEqual(t, "1", node.Group)
+	}
+}
+
+func Test_BuildGroupsByCommunity(t *testing.T) {
+	reviewGraph, err := Build(reviewPullDetails(), Options{
+		Group:        GROUP_BY_COMMUNITY,
+		StateWeights: map[string]float64{STATE_APPROVED: 1, STATE_COMMENTED: 0.5},
+	})
+	assert.Nil(t, err)
+
+	members := 0
+	for _, community := range reviewGraph.Communities {
+		members += len(community)
+	}
+	assert.Equal(t, 3, members)
+	for _, node := range reviewGraph.Nodes {
+		assert.NotEqual(t, "0", node.Group)
+	}
+}
+
+func Test_BuildTeamLevel(t *testing.T) {
+	identities, err := identity.NewMapping([]identity.Person{
+		{Login: "alice", Team: "api"},
+		{Login: "bob", Team: "web"},
+	})
+	assert.Nil(t, err)
+
+	pullDetails := reviewPullDetails()
+	// Reviews by deleted accounts don't become edges of the unassigned team.
+	pullDetails[0].Reviews = append(pullDetails[0].Reviews, newReview(newUser(4, "ghost"), STATE_APPROVED, time.Now()))
+
+	reviewGraph, err := Build(pullDetails, Options{Level: LEVEL_TEAM, Identities: identities})
+	assert.Nil(t, err)
+	assert.Len(t, reviewGraph.Edges, 2)
+	for _, edge := range reviewGraph.Edges {
+		assert.NotEqual(t, "ghost", edge.Source)
+		assert.NotEqual(t, "ghost", edge.Target)
+	}
+	assert.Equal(t, []string{"api", "web"}, reviewGraph.TeamMatrix.Teams)
+	assert.Equal(t, [][]int{{0, 1}, {2, 0}}, reviewGraph.TeamMatrix.Reviews)
+}
+
+func Test_EncodeEdgesCSV(t *testing.T) {
+	reviewGraph := &ReviewGraph{
+		Nodes: []Node{{ID: "alice"}, {ID: "bob"}},
+		Edges: []Edge{{
+			Source:             "alice",
+			Target:             "bob",
+			Value:              3,
+			Weight:             2.5,
+			States:             map[string]int{STATE_APPROVED: 2, STATE_COMMENTED: 1},
+			Repos:              []string{"o/a", "o/b"},
+			MedianLatencyHours: 1.5,
+		}},
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, Encode(&b, reviewGraph, FORMAT_EDGES_CSV))
+
+	records, err := csv.NewReader(&b).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"source", "target", "weight", "reviews", "approved", "changes_requested", "commented", "dismissed", "medianLatencyHours", "repos"},
+		{"alice", "bob", "2.5", "3", "2", "0", "1", "0", "1.5", "o/a,o/b"},
+	}, records)
+
+	assert.Error(t, Encode(&b, reviewGraph, "bogus"))
+}
+
+// encodedGraph has logins that need escaping in every format.
+func encodedGraph() *ReviewGraph {
+	return &ReviewGraph{
+		Nodes: []Node{{ID: "dependabot[bot]", PageRank: 0.25, Group: "1"}, {ID: `o"neil & co`, PageRank: 0.75, Group: "2"}},
+		Edges: []Edge{{Source: "dependabot[bot]", Target: `o"neil & co`, Value: 2, Weight: 1.5, Repos: []string{"o/a"}}},
+	}
+}
+
+func Test_EncodeGraphML(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, Encode(&b, encodedGraph(), FORMAT_GRAPHML))
+
+	var doc graphMLDocument
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &doc))
+	assert.Equal(t, "http://graphml.graphdrawing.org/xmlns", doc.XMLName.Space)
+	assert.Equal(t, "directed", doc.Graph.EdgeDefault)
+	assert.Len(t, doc.Graph.Nodes, 2)
+	assert.Equal(t, `o"neil & co`, doc.Graph.Nodes[1].ID)
+	assert.Equal(t, `o"neil & co`, doc.Graph.Edges[0].Target)
+	assert.Contains(t, doc.Graph.Edges[0].Data, graphMLData{Key: "weight", Value: "1.5"})
+	assert.Contains(t, doc.Graph.Edges[0].Data, graphMLData{Key: "reviews", Value: "2"})
+}
+
+func Test_EncodeGEXF(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, Encode(&b, encodedGraph(), FORMAT_GEXF))
+
+	var doc gexfDocument
+	assert.Nil(t, xml.Unmarshal(b.Bytes(), &doc))
+	assert.Equal(t, "http://www.gexf.net/1.2draft", doc.XMLName.Space)
+	assert.Equal(t, "1.2", doc.Version)
+	assert.Len(t, doc.Graph.Nodes, 2)
+	assert.Equal(t, "dependabot[bot]", doc.Graph.Nodes[0].Label)
+	assert.Contains(t, doc.Graph.Nodes[1].AttValues, gexfAttValue{For: "pageRank", Value: "0.75"})
+	assert.Equal(t, []gexfEdge{{ID: "0", Source: "dependabot[bot]", Target: `o"neil & co`, Weight: 1.5}}, doc.Graph.Edges)
+}
+
+func Test_EncodeDOT(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, Encode(&b, encodedGraph(), FORMAT_DOT))
+
+	dot := b.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph reviews {\n"))
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+	assert.Contains(t, dot, `  "dependabot[bot]" [score=0, pageRank=0.25,`)
+	assert.Contains(t, dot, `  "dependabot[bot]" -> "o\"neil & co" [weight=1.5, reviews=2, medianLatencyHours=0];`)
+	assert.Equal(t, `"a\\b"`, dotID(`a\b`))
+}
+
+func Test_ParseStateWeights(t *testing.T) {
+	stateWeights, err := ParseStateWeights("approved=1, changes_requested=1.5,COMMENTED=0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{STATE_APPROVED: 1, STATE_CHANGES_REQUESTED: 1.5, STATE_COMMENTED: 0.5}, stateWeights)
+
+	for _, spec := range []string{"approved", "merged=1", "approved=-1", "approved=x"} {
+		_, err := ParseStateWeights(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_ReviewEffort(t *testing.T) {
+	pullDetail := &forge.PullDetails{
+		PullRequest: &forge.PullRequest{Additions: gogithub.Int(100), Deletions: gogithub.Int(50), ChangedFiles: gogithub.Int(7)},
+	}
+	assert.Equal(t, 1.0, reviewEffort(pullDetail, WEIGHTING_COUNT))
+	assert.InDelta(t, 1+math.Log(151), reviewEffort(pullDetail, WEIGHTING_LINES), 1e-9)
+	assert.Equal(t, 7.0, reviewEffort(pullDetail, WEIGHTING_FILES))
+
+	empty := &forge.PullDetails{PullRequest: &forge.PullRequest{}}
+	assert.Equal(t, 1.0, reviewEffort(empty, WEIGHTING_LINES))
+	assert.Equal(t, 1.0, reviewEffort(empty, WEIGHTING_FILES))
+}
+
+func Test_Decay(t *testing.T) {
+	end := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	submittedAt := end.Add(-14 * 24 * time.Hour)
+	pullDetail := &forge.PullDetails{PullRequest: &forge.PullRequest{}}
+	review := &forge.PullRequestReview{SubmittedAt: &submittedAt}
+
+	assert.Equal(t, 1.0, decay(pullDetail, review, end, 0))
+	assert.InDelta(t, 0.5, decay(pullDetail, review, end, 14*24*time.Hour), 1e-9)
+	assert.InDelta(t, 0.25, decay(pullDetail, review, end, 7*24*time.Hour), 1e-9)
+	assert.Equal(t, 1.0, decay(pullDetail, review, submittedAt.Add(-time.Hour), 7*24*time.Hour))
+}
+
+func Test_RankMoversCompareRawValues(t *testing.T) {
+	// Both windows normalize alice to the top score, but alice's PageRank grew.
+	previous := &TimelineWindow{Nodes: []TimelineNode{{ID: "alice", Score: 10, Value: 0.3}, {ID: "bob", Score: 0, Value: 0.2}}}
+	current := &TimelineWindow{Nodes: []TimelineNode{{ID: "alice", Score: 10, Value: 0.5}, {ID: "bob", Score: 0, Value: 0.2}}}
+
+	delta := diffWindows(previous, current)
+	assert.Len(t, delta.RankMovers, 1)
+	assert.Equal(t, "alice", delta.RankMovers[0].ID)
+	assert.InDelta(t, 0.2, delta.RankMovers[0].Change, 1e-9)
+}
+
+func Test_DiffGraphsComparesWeights(t *testing.T) {
+	alice, bob := newUser(1, "alice"), newUser(2, "bob")
+	march := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	pullDetails := []*forge.PullDetails{
+		{
+			PullRequest: &forge.PullRequest{User: alice, CreatedAt: &march, Additions: gogithub.Int(10)},
+			Reviews:     []*forge.PullRequestReview{newReview(bob, STATE_APPROVED, march.Add(time.Hour))},
+		},
+		{
+			PullRequest: &forge.PullRequest{User: alice, CreatedAt: &april, Additions: gogithub.Int(1000)},
+			Reviews:     []*forge.PullRequestReview{newReview(bob, STATE_APPROVED, april.Add(time.Hour))},
+		},
+	}
+
+	diff, err := DiffGraphs(pullDetails,
+		TimeRange{Start: march, End: april.Add(-time.Second)},
+		TimeRange{Start: april, End: april.AddDate(0, 1, 0)},
+		Options{Weighting: WEIGHTING_LINES},
+	)
+	assert.Nil(t, err)
+
+	// The same number of reviews, but of a much larger pull request.
+	assert.Len(t, diff.ChangedEdges, 1)
+	change := diff.ChangedEdges[0]
+	assert.Equal(t, 0, change.Change)
+	assert.InDelta(t, 1+math.Log(11), change.PreviousWeight, 1e-9)
+	assert.InDelta(t, 1+math.Log(1001), change.CurrentWeight, 1e-9)
+	assert.Greater(t, change.WeightChange, 0.0)
+}
@@ -12,35 +12,33 @@ import (
 	"sync"
 	"time"
 
-	"github.com/mentallyanimated/reporeportcard-core/github"
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
 	"github.com/mentallyanimated/reporeportcard-core/store"
-	"gonum.org/v1/gonum/graph/network"
-	"gonum.org/v1/gonum/graph/simple"
+	"github.com/mentallyanimated/reporeportcard-core/team"
 )
 
-type forceGraphLink struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
-	Value  int    `json:"value"`
-}
-
+// forceGraphNode is a node in the schema react-force-graph reads, which
+// repeats each node's outgoing links and neighbors.
 type forceGraphNode struct {
-	ID        string           `json:"id"`
-	Score     float64          `json:"score"`
-	Neighbors []string         `json:"neighbors"`
-	Links     []forceGraphLink `json:"links"`
-	Group     string           `json:"group"`
+	Node
+	Neighbors []string `json:"neighbors"`
+	Links     []Edge   `json:"links"`
 }
 
 type forceGraph struct {
-	Nodes []forceGraphNode `json:"nodes"`
-	Links []forceGraphLink `json:"links"`
+	Nodes       []forceGraphNode `json:"nodes"`
+	Links       []Edge           `json:"links"`
+	Modularity  float64          `json:"modularity,omitempty"`
+	Communities [][]string       `json:"communities,omitempty"`
+	Excluded    *filter.Excluded `json:"excluded,omitempty"`
+	TeamMatrix  *team.Matrix     `json:"teamMatrix,omitempty"`
 }
 
 // ImportRawData assumes that you've downloaded the data from the github API
 // already and that it exists on disk. This will load every single pull request
 // into memory.
-func ImportRawData(owner, repo string) []*github.PullDetails {
+func ImportRawData(owner, repo string) []*forge.PullDetails {
 	rootDirName := fmt.Sprintf("%s/%s/%s", store.CACHE_PREFIX, owner, repo)
 
 	fileInfos, err := ioutil.ReadDir(rootDirName)
@@ -56,14 +54,14 @@ func ImportRawData(owner, repo string) []*github.PullDetails {
 			continue
 		}
 
-		if strings.EqualFold(fmt.Sprintf("%s.json", github.METADATA_KEY), fileInfo.Name()) {
+		if strings.EqualFold(fmt.Sprintf("%s.json", forge.METADATA_KEY), fileInfo.Name()) {
 			continue
 		}
 
 		filteredFileInfos = append(filteredFileInfos, fileInfo)
 	}
 
-	allPullDetails := make([]*github.PullDetails, len(filteredFileInfos), len(filteredFileInfos))
+	allPullDetails := make([]*forge.PullDetails, len(filteredFileInfos), len(filteredFileInfos))
 
 	type FileInfoTuple struct {
 		Index    int
@@ -89,7 +87,7 @@ func ImportRawData(owner, repo string) []*github.PullDetails {
 				return
 			}
 
-			var pull *github.PullRequest
+			var pull *forge.PullRequest
 			err = json.Unmarshal(pullBytes, &pull)
 			if err != nil {
 				log.Printf("Error parsing pull: %s", err)
@@ -102,7 +100,7 @@ func ImportRawData(owner, repo string) []*github.PullDetails {
 				return
 			}
 
-			var reviews []*github.PullRequestReview
+			var reviews []*forge.PullRequestReview
 			err = json.Unmarshal(reviewBytes, &reviews)
 			if err != nil {
 				log.Printf("Error parsing reviews: %s", err)
@@ -115,17 +113,45 @@ func ImportRawData(owner, repo string) []*github.PullDetails {
 				return
 			}
 
-			var files []*github.CommitFile
+			var files []*forge.CommitFile
 			err = json.Unmarshal(filesBytes, &files)
 			if err != nil {
 				log.Printf("Error parsing files: %s", err)
 				return
 			}
 
-			pullDetails := &github.PullDetails{
-				PullRequest: pull,
-				Reviews:     reviews,
-				Files:       files,
+			// Comments, commits and events are optional since pull requests
+			// downloaded before they were, or from providers without them,
+			// don't have any.
+			var reviewComments []*forge.PullRequestComment
+			if err := readOptionalJSON(fmt.Sprintf("%s/%d/review_comments.json", rootDirName, pull.GetNumber()), &reviewComments); err != nil {
+				log.Printf("Error parsing review comments: %s", err)
+			}
+
+			var comments []*forge.IssueComment
+			if err := readOptionalJSON(fmt.Sprintf("%s/%d/comments.json", rootDirName, pull.GetNumber()), &comments); err != nil {
+				log.Printf("Error parsing comments: %s", err)
+			}
+
+			var commits []*forge.RepositoryCommit
+			if err := readOptionalJSON(fmt.Sprintf("%s/%d/commits.json", rootDirName, pull.GetNumber()), &commits); err != nil {
+				log.Printf("Error parsing commits: %s", err)
+			}
+
+			var events []*forge.IssueEvent
+			if err := readOptionalJSON(fmt.Sprintf("%s/%d/events.json", rootDirName, pull.GetNumber()), &events); err != nil {
+				log.Printf("Error parsing events: %s", err)
+			}
+
+			pullDetails := &forge.PullDetails{
+				Repo:           fmt.Sprintf("%s/%s", owner, repo),
+				PullRequest:    pull,
+				Reviews:        reviews,
+				Files:          files,
+				ReviewComments: reviewComments,
+				Comments:       comments,
+				Commits:        commits,
+				Events:         events,
 			}
 			allPullDetails[i] = pullDetails
 			wg.Done()
@@ -137,11 +163,39 @@ func ImportRawData(owner, repo string) []*github.PullDetails {
 	return allPullDetails
 }
 
+// readOptionalJSON unmarshals filename into v, leaving v untouched when the
+// file doesn't exist.
+func readOptionalJSON(filename string, v interface{}) error {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ImportRepos imports the pull requests of every "owner/repo" in repos so they
+// can be analyzed as a single graph.
+func ImportRepos(repos []string) []*forge.PullDetails {
+	allPullDetails := []*forge.PullDetails{}
+	for _, fullName := range repos {
+		owner, repo, ok := store.SplitRepo(fullName)
+		if !ok {
+			log.Printf("Skipping invalid repository name %q", fullName)
+			continue
+		}
+		allPullDetails = append(allPullDetails, ImportRawData(owner, repo)...)
+	}
+	return allPullDetails
+}
+
 // FilterPullDetailsByTime does a client side filtering of the pull details
-func FilterPullDetailsByTime(pullDetails []*github.PullDetails, start, end time.Time) []*github.PullDetails {
+func FilterPullDetailsByTime(pullDetails []*forge.PullDetails, start, end time.Time) []*forge.PullDetails {
 	// TODO: Handle unspecified start/end times
 
-	filteredPullDetails := []*github.PullDetails{}
+	filteredPullDetails := []*forge.PullDetails{}
 
 	// Sort by GetCreatedAt
 	sort.Slice(pullDetails, func(i, j int) bool {
@@ -161,132 +215,45 @@ func FilterPullDetailsByTime(pullDetails []*github.PullDetails, start, end time.
 	return filteredPullDetails
 }
 
-func BuildForceGraph(owner, repo string, pullDetails []*github.PullDetails, w io.Writer) {
+// BuildForceGraph builds the graph of the pull requests and writes it to w in
+// the react-force-graph JSON schema.
+func BuildForceGraph(owner, repo string, pullDetails []*forge.PullDetails, opts Options, w io.Writer) error {
 	log.Printf("Building force graph for %s/%s out of %d pull requests", owner, repo, len(pullDetails))
 
-	userIDToLogin := map[int64]string{}
-	edgeFrequency := map[simple.Edge]int{}
-	totalApprovalCount := 0
-
-	for _, pullDetail := range pullDetails {
-		requestorID := pullDetail.PullRequest.GetUser().GetID()
-		requestorLogin := pullDetail.PullRequest.GetUser().GetLogin()
-
-		for _, review := range pullDetail.Reviews {
-			if review.GetState() != "APPROVED" {
-				continue
-			}
-			reviewerID := review.GetUser().GetID()
-			reviewerLogin := review.GetUser().GetLogin()
-
-			if requestorLogin == "" || reviewerLogin == "" {
-				continue
-			}
-
-			if requestorLogin == "ghost" || reviewerLogin == "ghost" {
-				continue
-			}
-
-			userIDToLogin[requestorID] = requestorLogin
-			userIDToLogin[reviewerID] = reviewerLogin
-
-			edge := simple.Edge{
-				F: simple.Node(requestorID),
-				T: simple.Node(reviewerID),
-			}
-
-			if _, ok := edgeFrequency[edge]; ok {
-				edgeFrequency[edge]++
-			} else {
-				edgeFrequency[edge] = 1
-			}
-
-			totalApprovalCount++
-		}
-	}
-
-	graph := simple.NewWeightedDirectedGraph(0, 0)
-
-	for edge, frequency := range edgeFrequency {
-		graph.SetWeightedEdge(simple.WeightedEdge{
-			F: edge.F,
-			T: edge.T,
-			W: (float64(frequency) / float64(totalApprovalCount)) * 100,
-		})
+	reviewGraph, err := Build(pullDetails, opts)
+	if err != nil {
+		return err
 	}
+	return Encode(w, reviewGraph, FORMAT_JSON)
+}
 
-	pageRank := network.PageRank(graph, 0.85, 0.00000001)
-	var minRankScore, maxRankScore float64
-
-	forceGraphNodes := []forceGraphNode{}
-	forceGraphLinks := []forceGraphLink{}
-	nodeToNeighbors := make(map[string][]string)
-
-	for edge := range edgeFrequency {
-		fLogin := userIDToLogin[edge.F.ID()]
-		tLogin := userIDToLogin[edge.T.ID()]
-
-		if _, ok := nodeToNeighbors[fLogin]; !ok {
-			nodeToNeighbors[fLogin] = []string{}
-		}
-		if _, ok := nodeToNeighbors[tLogin]; !ok {
-			nodeToNeighbors[tLogin] = []string{}
-		}
-
-		nodeToNeighbors[fLogin] = append(nodeToNeighbors[fLogin], tLogin)
+func newForceGraph(reviewGraph *ReviewGraph) *forceGraph {
+	nodeToNeighbors := map[string][]string{}
+	nodeToLinks := map[string][]Edge{}
+	for _, node := range reviewGraph.Nodes {
+		nodeToNeighbors[node.ID] = []string{}
+		nodeToLinks[node.ID] = []Edge{}
 	}
-
-	for _, rank := range pageRank {
-		if rank < minRankScore || minRankScore == 0 {
-			minRankScore = rank
-		}
-		if rank > maxRankScore {
-			maxRankScore = rank
-		}
+	for _, edge := range reviewGraph.Edges {
+		nodeToNeighbors[edge.Source] = append(nodeToNeighbors[edge.Source], edge.Target)
+		nodeToLinks[edge.Source] = append(nodeToLinks[edge.Source], edge)
 	}
 
-	for id, rank := range pageRank {
-		links := []forceGraphLink{}
-
-		for edge, freq := range edgeFrequency {
-			if edge.F.ID() == id {
-				links = append(links, forceGraphLink{
-					Source: userIDToLogin[edge.F.ID()],
-					Target: userIDToLogin[edge.T.ID()],
-					Value:  freq,
-				})
-			}
-		}
-
-		adjustedRank := 10 * ((rank - minRankScore) / (maxRankScore - minRankScore))
-
-		group := 1
-		for rank < maxRankScore {
-			rank *= 2
-			group++
-		}
-
+	forceGraphNodes := []forceGraphNode{}
+	for _, node := range reviewGraph.Nodes {
 		forceGraphNodes = append(forceGraphNodes, forceGraphNode{
-			ID:        userIDToLogin[id],
-			Score:     adjustedRank,
-			Neighbors: nodeToNeighbors[userIDToLogin[id]],
-			Links:     links,
-			Group:     fmt.Sprintf("%d", group),
+			Node:      node,
+			Neighbors: nodeToNeighbors[node.ID],
+			Links:     nodeToLinks[node.ID],
 		})
 	}
 
-	for edge, frequency := range edgeFrequency {
-		forceGraphLinks = append(forceGraphLinks, forceGraphLink{
-			Source: userIDToLogin[edge.F.ID()],
-			Target: userIDToLogin[edge.T.ID()],
-			Value:  frequency,
-		})
-	}
-
-	forceGraph := forceGraph{
-		Nodes: forceGraphNodes,
-		Links: forceGraphLinks,
+	return &forceGraph{
+		Nodes:       forceGraphNodes,
+		Links:       reviewGraph.Edges,
+		Modularity:  reviewGraph.Modularity,
+		Communities: reviewGraph.Communities,
+		Excluded:    reviewGraph.Metadata.Excluded,
+		TeamMatrix:  reviewGraph.TeamMatrix,
 	}
-
-	json.NewEncoder(w).Encode(forceGraph)
 }
@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// writePullRequest stores a pull request the way forge.Sync does.
+func writePullRequest(t *testing.T, cache store.Store, number int, author string) {
+	t.Helper()
+	values := map[string]interface{}{
+		fmt.Sprint(number):                &forge.PullRequest{Number: gogithub.Int(number), User: newUser(1, author)},
+		fmt.Sprintf("%d/reviews", number): []*forge.PullRequestReview{},
+		fmt.Sprintf("%d/files", number):   []*forge.CommitFile{},
+	}
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		assert.Nil(t, err)
+		assert.Nil(t, cache.Put(key, data))
+	}
+}
+
+func Test_ImportRepos(t *testing.T) {
+	assert := assert.New(t)
+	wd, err := os.Getwd()
+	assert.Nil(err)
+	assert.Nil(os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	writePullRequest(t, store.NewDisk("o", "a"), 1, "alice")
+	writePullRequest(t, store.NewDisk("o", "a"), 2, "bob")
+	writePullRequest(t, store.NewDisk("group/sub", "b"), 1, "carol")
+
+	pullDetails := ImportRepos([]string{"o/a", "group/sub/b", "invalid", "o/missing"})
+	got := []string{}
+	for _, pullDetail := range pullDetails {
+		got = append(got, fmt.Sprintf("%s#%d", pullDetail.Repo, pullDetail.PullRequest.GetNumber()))
+	}
+	sort.Strings(got)
+	assert.Equal([]string{"group/sub/b#1", "o/a#1", "o/a#2"}, got)
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	STATE_APPROVED          = "APPROVED"
+	STATE_CHANGES_REQUESTED = "CHANGES_REQUESTED"
+	STATE_COMMENTED         = "COMMENTED"
+	STATE_DISMISSED         = "DISMISSED"
+)
+
+// REVIEW_STATES lists the review states in the order they're reported.
+var REVIEW_STATES = []string{STATE_APPROVED, STATE_CHANGES_REQUESTED, STATE_COMMENTED, STATE_DISMISSED}
+
+// DefaultStateWeights only counts approvals, which is how the graph has
+// always been built.
+func DefaultStateWeights() map[string]float64 {
+	return map[string]float64{STATE_APPROVED: 1}
+}
+
+// ParseStateWeights parses a comma separated list of state=weight pairs such
+// as "approved=1,changes_requested=1.5,commented=0.5". States are case
+// insensitive and states that aren't listed don't contribute edges.
+func ParseStateWeights(spec string) (map[string]float64, error) {
+	stateWeights := map[string]float64{}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid state weight %q", pair)
+		}
+
+		state, weightString := strings.ToUpper(strings.TrimSpace(parts[0])), parts[1]
+		if !isReviewState(state) {
+			return nil, fmt.Errorf("unknown review state %q", state)
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightString), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", weightString, state)
+		}
+		stateWeights[state] = weight
+	}
+	return stateWeights, nil
+}
+
+func isReviewState(state string) bool {
+	for _, s := range REVIEW_STATES {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
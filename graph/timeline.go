@@ -0,0 +1,277 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	INTERVAL_WEEKLY  = "weekly"
+	INTERVAL_MONTHLY = "monthly"
+	// INTERVAL_SLIDING windows are TimelineOptions.Days long and start every
+	// TimelineOptions.Step days, so consecutive windows can overlap.
+	INTERVAL_SLIDING = "sliding"
+
+	// MAX_WINDOWS bounds how many graphs a single timeline builds.
+	MAX_WINDOWS = 520
+	// MAX_RANK_MOVERS is how many of the largest metric changes are reported
+	// per window.
+	MAX_RANK_MOVERS = 10
+)
+
+type TimelineOptions struct {
+	Interval string
+	Days     int
+	Step     int
+}
+
+// TimelineNode carries both the Score normalized within its window and the
+// raw Value of the metric it was computed from, which is what rank movers
+// compare across windows.
+type TimelineNode struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	Value float64 `json:"value"`
+}
+
+// TimelineEdge has the review count of an edge as Value and its Weight under
+// the graph options, which new and removed edges are ranked by.
+type TimelineEdge struct {
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Value  int     `json:"value"`
+	Weight float64 `json:"weight"`
+}
+
+// RankMove is the change in the raw value of the selected metric.
+type RankMove struct {
+	ID       string  `json:"id"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"`
+}
+
+// TimelineDelta compares a window to the one before it.
+type TimelineDelta struct {
+	NewReviewers  []string       `json:"newReviewers"`
+	GoneReviewers []string       `json:"goneReviewers"`
+	NewEdges      []TimelineEdge `json:"newEdges"`
+	RemovedEdges  []TimelineEdge `json:"removedEdges"`
+	RankMovers    []RankMove     `json:"rankMovers"`
+}
+
+type TimelineWindow struct {
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	PullRequests int            `json:"pullRequests"`
+	Nodes        []TimelineNode `json:"nodes"`
+	Edges        []TimelineEdge `json:"edges"`
+	// Delta is nil for the first window.
+	Delta *TimelineDelta `json:"delta"`
+}
+
+type Timeline struct {
+	Interval string           `json:"interval"`
+	Windows  []TimelineWindow `json:"windows"`
+}
+
+// nextWindow returns the start of the window after the one starting at start,
+// and the end of the window starting at start.
+func nextWindow(start time.Time, timelineOpts TimelineOptions) (time.Time, time.Time) {
+	switch timelineOpts.Interval {
+	case INTERVAL_MONTHLY:
+		end := start.AddDate(0, 1, 0)
+		return end, end
+	case INTERVAL_SLIDING:
+		return start.AddDate(0, 0, timelineOpts.Step), start.AddDate(0, 0, timelineOpts.Days)
+	default:
+		end := start.AddDate(0, 0, 7)
+		return end, end
+	}
+}
+
+func validateTimelineOptions(timelineOpts *TimelineOptions) error {
+	switch timelineOpts.Interval {
+	case "":
+		timelineOpts.Interval = INTERVAL_WEEKLY
+	case INTERVAL_WEEKLY, INTERVAL_MONTHLY:
+	case INTERVAL_SLIDING:
+		if timelineOpts.Days <= 0 {
+			return errors.New("sliding windows need a positive number of days")
+		}
+		if timelineOpts.Step <= 0 {
+			timelineOpts.Step = 7
+		}
+	default:
+		return fmt.Errorf("unknown interval %q", timelineOpts.Interval)
+	}
+	return nil
+}
+
+// BuildTimeline splits start..end into windows and builds a graph for each of
+// them. The range is narrowed to the pull requests that exist so an open
+// ended range doesn't produce empty windows back to 1970.
+func BuildTimeline(pullDetails []*forge.PullDetails, start, end time.Time, opts Options, timelineOpts TimelineOptions) (*Timeline, error) {
+	if err := validateTimelineOptions(&timelineOpts); err != nil {
+		return nil, err
+	}
+
+	timeline := &Timeline{
+		Interval: timelineOpts.Interval,
+		Windows:  []TimelineWindow{},
+	}
+
+	pullDetails = FilterPullDetailsByTime(pullDetails, start, end)
+	if len(pullDetails) == 0 {
+		return timeline, nil
+	}
+	if first := pullDetails[0].PullRequest.GetCreatedAt(); first.After(start) {
+		start = first.Truncate(24 * time.Hour)
+	}
+	if last := pullDetails[len(pullDetails)-1].PullRequest.GetCreatedAt(); last.Before(end) {
+		end = last
+	}
+
+	var previous *TimelineWindow
+	for windowStart := start; !windowStart.After(end); {
+		if len(timeline.Windows) == MAX_WINDOWS {
+			return nil, fmt.Errorf("more than %d windows", MAX_WINDOWS)
+		}
+
+		nextStart, windowEnd := nextWindow(windowStart, timelineOpts)
+		windowPullDetails := FilterPullDetailsByTime(pullDetails, windowStart, windowEnd.Add(-time.Nanosecond))
+		windowOpts := opts
+		windowOpts.End = windowEnd
+		g, err := Build(windowPullDetails, windowOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		window := TimelineWindow{
+			Start:        windowStart,
+			End:          windowEnd,
+			PullRequests: len(windowPullDetails),
+			Nodes:        []TimelineNode{},
+			Edges:        []TimelineEdge{},
+		}
+		for _, node := range g.Nodes {
+			window.Nodes = append(window.Nodes, TimelineNode{ID: node.ID, Score: node.Score, Value: node.metric(g.Metadata.Metric)})
+		}
+		for _, link := range g.Edges {
+			window.Edges = append(window.Edges, TimelineEdge{Source: link.Source, Target: link.Target, Value: link.Value, Weight: link.Weight})
+		}
+
+		if previous != nil {
+			window.Delta = diffWindows(previous, &window)
+		}
+
+		timeline.Windows = append(timeline.Windows, window)
+		previous = &window
+		windowStart = nextStart
+	}
+
+	return timeline, nil
+}
+
+// sortTimelineEdges orders edges from the heaviest to the lightest.
+func sortTimelineEdges(edges []TimelineEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Weight != edges[j].Weight {
+			return edges[i].Weight > edges[j].Weight
+		}
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+}
+
+func reviewers(window *TimelineWindow) map[string]bool {
+	logins := map[string]bool{}
+	for _, edge := range window.Edges {
+		logins[edge.Target] = true
+	}
+	return logins
+}
+
+func edgeSet(window *TimelineWindow) map[[2]string]TimelineEdge {
+	edges := map[[2]string]TimelineEdge{}
+	for _, edge := range window.Edges {
+		edges[[2]string{edge.Source, edge.Target}] = edge
+	}
+	return edges
+}
+
+func diffWindows(previous, current *TimelineWindow) *TimelineDelta {
+	delta := &TimelineDelta{
+		NewReviewers:  []string{},
+		GoneReviewers: []string{},
+		NewEdges:      []TimelineEdge{},
+		RemovedEdges:  []TimelineEdge{},
+		RankMovers:    []RankMove{},
+	}
+
+	previousReviewers, currentReviewers := reviewers(previous), reviewers(current)
+	for login := range currentReviewers {
+		if !previousReviewers[login] {
+			delta.NewReviewers = append(delta.NewReviewers, login)
+		}
+	}
+	for login := range previousReviewers {
+		if !currentReviewers[login] {
+			delta.GoneReviewers = append(delta.GoneReviewers, login)
+		}
+	}
+	sort.Strings(delta.NewReviewers)
+	sort.Strings(delta.GoneReviewers)
+
+	previousEdges, currentEdges := edgeSet(previous), edgeSet(current)
+	for key, edge := range currentEdges {
+		if _, ok := previousEdges[key]; !ok {
+			delta.NewEdges = append(delta.NewEdges, edge)
+		}
+	}
+	for key, edge := range previousEdges {
+		if _, ok := currentEdges[key]; !ok {
+			delta.RemovedEdges = append(delta.RemovedEdges, edge)
+		}
+	}
+	sortTimelineEdges(delta.NewEdges)
+	sortTimelineEdges(delta.RemovedEdges)
+
+	// Scores are normalized within each window, so movers are found from the
+	// raw metric values.
+	previousValues := map[string]float64{}
+	for _, node := range previous.Nodes {
+		previousValues[node.ID] = node.Value
+	}
+	for _, node := range current.Nodes {
+		previousValue, ok := previousValues[node.ID]
+		if !ok || previousValue == node.Value {
+			continue
+		}
+		delta.RankMovers = append(delta.RankMovers, RankMove{
+			ID:       node.ID,
+			Previous: previousValue,
+			Current:  node.Value,
+			Change:   node.Value - previousValue,
+		})
+	}
+	sort.Slice(delta.RankMovers, func(i, j int) bool {
+		a, b := math.Abs(delta.RankMovers[i].Change), math.Abs(delta.RankMovers[j].Change)
+		if a != b {
+			return a > b
+		}
+		return delta.RankMovers[i].ID < delta.RankMovers[j].ID
+	})
+	if len(delta.RankMovers) > MAX_RANK_MOVERS {
+		delta.RankMovers = delta.RankMovers[:MAX_RANK_MOVERS]
+	}
+
+	return delta
+}
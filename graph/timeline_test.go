@@ -0,0 +1,119 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2022, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// timelinePullDetails has bob reviewing alice in the first week, carol and
+// alice taking over in the second, nothing in the third and carol reviewing
+// alice again in the fourth.
+func timelinePullDetails() []*forge.PullDetails {
+	alice, bob, carol := newUser(1, "alice"), newUser(2, "bob"), newUser(3, "carol")
+	pullRequest := func(author *forge.User, createdAt time.Time, reviewer *forge.User) *forge.PullDetails {
+		return &forge.PullDetails{
+			PullRequest: &forge.PullRequest{User: author, CreatedAt: &createdAt},
+			Reviews:     []*forge.PullRequestReview{newReview(reviewer, STATE_APPROVED, createdAt.Add(time.Hour))},
+		}
+	}
+	return []*forge.PullDetails{
+		pullRequest(alice, day(time.March, 7).Add(10*time.Hour), bob),
+		pullRequest(alice, day(time.March, 15), carol),
+		pullRequest(bob, day(time.March, 16), alice),
+		pullRequest(alice, day(time.April, 2), carol),
+	}
+}
+
+func windowBounds(timeline *Timeline) [][2]time.Time {
+	bounds := [][2]time.Time{}
+	for _, window := range timeline.Windows {
+		bounds = append(bounds, [2]time.Time{window.Start, window.End})
+	}
+	return bounds
+}
+
+func windowPullRequests(timeline *Timeline) []int {
+	pullRequests := []int{}
+	for _, window := range timeline.Windows {
+		pullRequests = append(pullRequests, window.PullRequests)
+	}
+	return pullRequests
+}
+
+func Test_BuildTimelineWeekly(t *testing.T) {
+	assert := assert.New(t)
+	timeline, err := BuildTimeline(timelinePullDetails(), time.Time{}, day(time.December, 31), Options{}, TimelineOptions{})
+	assert.Nil(err)
+
+	assert.Equal(INTERVAL_WEEKLY, timeline.Interval)
+	assert.Equal([][2]time.Time{
+		{day(time.March, 7), day(time.March, 14)},
+		{day(time.March, 14), day(time.March, 21)},
+		{day(time.March, 21), day(time.March, 28)},
+		{day(time.March, 28), day(time.April, 4)},
+	}, windowBounds(timeline))
+	assert.Equal([]int{1, 2, 0, 1}, windowPullRequests(timeline))
+	assert.Nil(timeline.Windows[0].Delta)
+
+	delta := timeline.Windows[1].Delta
+	assert.Equal([]string{"alice", "carol"}, delta.NewReviewers)
+	assert.Equal([]string{"bob"}, delta.GoneReviewers)
+	assert.Equal([]TimelineEdge{
+		{Source: "alice", Target: "carol", Value: 1, Weight: 1},
+		{Source: "bob", Target: "alice", Value: 1, Weight: 1},
+	}, delta.NewEdges)
+	assert.Equal([]TimelineEdge{{Source: "alice", Target: "bob", Value: 1, Weight: 1}}, delta.RemovedEdges)
+
+	delta = timeline.Windows[2].Delta
+	assert.Empty(delta.NewReviewers)
+	assert.Equal([]string{"alice", "carol"}, delta.GoneReviewers)
+	assert.Len(delta.RemovedEdges, 2)
+
+	delta = timeline.Windows[3].Delta
+	assert.Equal([]string{"carol"}, delta.NewReviewers)
+	assert.Equal([]TimelineEdge{{Source: "alice", Target: "carol", Value: 1, Weight: 1}}, delta.NewEdges)
+}
+
+func Test_BuildTimelineMonthly(t *testing.T) {
+	assert := assert.New(t)
+	timeline, err := BuildTimeline(timelinePullDetails(), time.Time{}, day(time.December, 31), Options{}, TimelineOptions{Interval: INTERVAL_MONTHLY})
+	assert.Nil(err)
+
+	assert.Equal([][2]time.Time{{day(time.March, 7), day(time.April, 7)}}, windowBounds(timeline))
+	assert.Equal([]int{4}, windowPullRequests(timeline))
+}
+
+func Test_BuildTimelineSliding(t *testing.T) {
+	assert := assert.New(t)
+	timeline, err := BuildTimeline(timelinePullDetails(), time.Time{}, day(time.December, 31), Options{}, TimelineOptions{Interval: INTERVAL_SLIDING, Days: 14, Step: 7})
+	assert.Nil(err)
+
+	assert.Equal([][2]time.Time{
+		{day(time.March, 7), day(time.March, 21)},
+		{day(time.March, 14), day(time.March, 28)},
+		{day(time.March, 21), day(time.April, 4)},
+		{day(time.March, 28), day(time.April, 11)},
+	}, windowBounds(timeline))
+	assert.Equal([]int{3, 2, 1, 1}, windowPullRequests(timeline))
+
+	// bob's review falls out of the second window while alice's stays.
+	delta := timeline.Windows[1].Delta
+	assert.Equal([]string{"bob"}, delta.GoneReviewers)
+	assert.Equal([]TimelineEdge{{Source: "alice", Target: "bob", Value: 1, Weight: 1}}, delta.RemovedEdges)
+	assert.Empty(delta.NewEdges)
+}
+
+func Test_BuildTimelineInvalidOptions(t *testing.T) {
+	_, err := BuildTimeline(timelinePullDetails(), time.Time{}, day(time.December, 31), Options{}, TimelineOptions{Interval: "daily"})
+	assert.Error(t, err)
+
+	_, err = BuildTimeline(timelinePullDetails(), time.Time{}, day(time.December, 31), Options{}, TimelineOptions{Interval: INTERVAL_SLIDING})
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"math"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	// WEIGHTING_COUNT counts every review the same, regardless of the size of
+	// the pull request.
+	WEIGHTING_COUNT = "count"
+	// WEIGHTING_LINES weighs reviews by 1 + ln(1 + lines changed), so large
+	// pull requests count for more without drowning out everything else.
+	WEIGHTING_LINES = "lines"
+	// WEIGHTING_FILES weighs reviews by the number of files touched.
+	WEIGHTING_FILES = "files"
+)
+
+// IsValidWeighting reports whether weighting is one of the WEIGHTING_
+// constants.
+func IsValidWeighting(weighting string) bool {
+	switch weighting {
+	case WEIGHTING_COUNT, WEIGHTING_LINES, WEIGHTING_FILES:
+		return true
+	default:
+		return false
+	}
+}
+
+// reviewEffort is how much a review of the pull request weighs under the
+// weighting strategy. It's never below 1 so pull requests without size
+// information still contribute edges.
+func reviewEffort(pullDetail *forge.PullDetails, weighting string) float64 {
+	switch weighting {
+	case WEIGHTING_LINES:
+		return 1 + math.Log1p(float64(pullDetail.LinesChanged()))
+	case WEIGHTING_FILES:
+		return math.Max(1, float64(pullDetail.FilesChanged()))
+	default:
+		return 1
+	}
+}
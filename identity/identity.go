@@ -0,0 +1,204 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strings"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+// Person is someone who may review under several accounts. Accounts are
+// matched by login, user ID or email and all become Login.
+type Person struct {
+	Login   string   `json:"login"`
+	Name    string   `json:"name"`
+	Team    string   `json:"team"`
+	Aliases []string `json:"aliases"`
+	IDs     []int64  `json:"ids"`
+	Emails  []string `json:"emails"`
+}
+
+// Mapping collapses the accounts of every listed person. The file is a JSON
+// object with a people array of Person.
+type Mapping struct {
+	People []Person `json:"people"`
+
+	byLogin map[string]*Person
+	byID    map[int64]*Person
+	byEmail map[string]*Person
+}
+
+// Teams lists the logins of the people in every team named by Person.Team.
+func (m *Mapping) Teams() map[string][]string {
+	teams := map[string][]string{}
+	for _, person := range m.People {
+		if person.Team != "" {
+			teams[person.Team] = append(teams[person.Team], person.Login)
+		}
+	}
+	return teams
+}
+
+// Load reads a mapping from a JSON file.
+func Load(filename string) (*Mapping, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if err := m.index(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// NewMapping builds a mapping from people, failing when an account belongs to
+// more than one of them.
+func NewMapping(people []Person) (*Mapping, error) {
+	m := &Mapping{People: people}
+	if err := m.index(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Mapping) index() error {
+	m.byLogin = map[string]*Person{}
+	m.byID = map[int64]*Person{}
+	m.byEmail = map[string]*Person{}
+
+	for i := range m.People {
+		person := &m.People[i]
+		if person.Login == "" {
+			return fmt.Errorf("person %d has no login", i)
+		}
+
+		for _, login := range append([]string{person.Login}, person.Aliases...) {
+			key := strings.ToLower(login)
+			if other, ok := m.byLogin[key]; ok && other != person {
+				return fmt.Errorf("login %q belongs to both %s and %s", login, other.Login, person.Login)
+			}
+			m.byLogin[key] = person
+		}
+		for _, id := range person.IDs {
+			if other, ok := m.byID[id]; ok && other != person {
+				return fmt.Errorf("user ID %d belongs to both %s and %s", id, other.Login, person.Login)
+			}
+			m.byID[id] = person
+		}
+		for _, email := range person.Emails {
+			key := strings.ToLower(email)
+			if other, ok := m.byEmail[key]; ok && other != person {
+				return fmt.Errorf("email %q belongs to both %s and %s", email, other.Login, person.Login)
+			}
+			m.byEmail[key] = person
+		}
+	}
+	return nil
+}
+
+// Lookup returns the person an account belongs to.
+func (m *Mapping) Lookup(user *forge.User) (*Person, bool) {
+	if user == nil {
+		return nil, false
+	}
+	if person, ok := m.byID[user.GetID()]; ok && user.ID != nil {
+		return person, true
+	}
+	if person, ok := m.byLogin[strings.ToLower(user.GetLogin())]; ok && user.GetLogin() != "" {
+		return person, true
+	}
+	if person, ok := m.byEmail[strings.ToLower(user.GetEmail())]; ok && user.GetEmail() != "" {
+		return person, true
+	}
+	return nil, false
+}
+
+// PersonByLogin returns the person whose canonical login is login.
+func (m *Mapping) PersonByLogin(login string) (*Person, bool) {
+	person, ok := m.byLogin[strings.ToLower(login)]
+	if !ok || !strings.EqualFold(person.Login, login) {
+		return nil, false
+	}
+	return person, true
+}
+
+// canonicalID is the person's first user ID, or a hash of their login so every
+// account of someone without IDs still shares one.
+func (p *Person) canonicalID() int64 {
+	if len(p.IDs) > 0 {
+		return p.IDs[0]
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.ToLower(p.Login)))
+	return int64(hash.Sum64() & 0x7fffffffffffffff)
+}
+
+// resolve returns the canonical account of user, or user itself when it
+// isn't mapped.
+func (m *Mapping) resolve(user *forge.User) *forge.User {
+	person, ok := m.Lookup(user)
+	if !ok {
+		return user
+	}
+
+	canonical := *user
+	canonical.ID = gogithub.Int64(person.canonicalID())
+	canonical.Login = gogithub.String(person.Login)
+	if person.Name != "" {
+		canonical.Name = gogithub.String(person.Name)
+	}
+	return &canonical
+}
+
+// Apply returns copies of the pull requests whose authors, reviewers and
+// requested reviewers are replaced by the canonical account of the person they
+// belong to. The given pull requests are left untouched.
+func (m *Mapping) Apply(pullDetails []*forge.PullDetails) []*forge.PullDetails {
+	mappedPullDetails := make([]*forge.PullDetails, 0, len(pullDetails))
+	for _, pullDetail := range pullDetails {
+		pull := *pullDetail.PullRequest
+		pull.User = m.resolve(pull.User)
+		if pull.RequestedReviewers != nil {
+			pull.RequestedReviewers = make([]*forge.User, 0, len(pullDetail.PullRequest.RequestedReviewers))
+			for _, reviewer := range pullDetail.PullRequest.RequestedReviewers {
+				pull.RequestedReviewers = append(pull.RequestedReviewers, m.resolve(reviewer))
+			}
+		}
+
+		reviews := make([]*forge.PullRequestReview, 0, len(pullDetail.Reviews))
+		for _, review := range pullDetail.Reviews {
+			mappedReview := *review
+			mappedReview.User = m.resolve(review.User)
+			reviews = append(reviews, &mappedReview)
+		}
+
+		// Events stay nil when they weren't downloaded.
+		var events []*forge.IssueEvent
+		if pullDetail.Events != nil {
+			events = make([]*forge.IssueEvent, 0, len(pullDetail.Events))
+			for _, event := range pullDetail.Events {
+				mappedEvent := *event
+				if event.RequestedReviewer != nil {
+					mappedEvent.RequestedReviewer = m.resolve(event.RequestedReviewer)
+				}
+				events = append(events, &mappedEvent)
+			}
+		}
+
+		mappedPullDetail := *pullDetail
+		mappedPullDetail.PullRequest = &pull
+		mappedPullDetail.Reviews = reviews
+		mappedPullDetail.Events = events
+		mappedPullDetails = append(mappedPullDetails, &mappedPullDetail)
+	}
+	return mappedPullDetails
+}
@@ -0,0 +1,53 @@
+package identity
+
+import (
+	"testing"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Apply(t *testing.T) {
+	m, err := NewMapping([]Person{{
+		Login:   "alice",
+		Name:    "Alice Liddell",
+		Team:    "platform",
+		Aliases: []string{"alice-contractor"},
+		IDs:     []int64{1, 2},
+		Emails:  []string{"Alice@Example.com"},
+	}})
+	assert.Nil(t, err)
+
+	pullDetails := []*forge.PullDetails{{
+		PullRequest: &forge.PullRequest{User: &forge.User{ID: gogithub.Int64(2), Login: gogithub.String("alice-work")}},
+		Reviews: []*forge.PullRequestReview{
+			{User: &forge.User{ID: gogithub.Int64(9), Login: gogithub.String("Alice-Contractor")}},
+			{User: &forge.User{ID: gogithub.Int64(8), Login: gogithub.String("alice@example.com"), Email: gogithub.String("alice@example.com")}},
+			{User: &forge.User{ID: gogithub.Int64(7), Login: gogithub.String("bob")}},
+		},
+	}}
+
+	mapped := m.Apply(pullDetails)
+	for _, user := range []*forge.User{mapped[0].PullRequest.User, mapped[0].Reviews[0].User, mapped[0].Reviews[1].User} {
+		assert.Equal(t, int64(1), user.GetID())
+		assert.Equal(t, "alice", user.GetLogin())
+		assert.Equal(t, "Alice Liddell", user.GetName())
+	}
+	assert.Equal(t, "bob", mapped[0].Reviews[2].User.GetLogin())
+	assert.Equal(t, "alice-work", pullDetails[0].PullRequest.User.GetLogin(), "the given pull requests must not be modified")
+
+	person, ok := m.PersonByLogin("alice")
+	assert.True(t, ok)
+	assert.Equal(t, "platform", person.Team)
+	_, ok = m.PersonByLogin("alice-contractor")
+	assert.False(t, ok)
+}
+
+func Test_NewMappingConflict(t *testing.T) {
+	_, err := NewMapping([]Person{
+		{Login: "alice", Aliases: []string{"shared"}},
+		{Login: "bob", Aliases: []string{"shared"}},
+	})
+	assert.Error(t, err)
+}
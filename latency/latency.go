@@ -0,0 +1,195 @@
+package latency
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+// Distribution summarizes a set of durations in hours.
+type Distribution struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// Latencies measure how long pull requests wait, from the time they were
+// opened, for their first review, their first approval and for being merged.
+type Latencies struct {
+	TimeToFirstReview Distribution `json:"timeToFirstReview"`
+	TimeToApproval    Distribution `json:"timeToApproval"`
+	TimeToMerge       Distribution `json:"timeToMerge"`
+}
+
+// Report breaks latencies down per repository, per pull request author and
+// per reviewer. A reviewer's latencies only cover their own reviews, while
+// their time to merge covers the pull requests they reviewed.
+type Report struct {
+	Overall   Latencies            `json:"overall"`
+	Repos     map[string]Latencies `json:"repos"`
+	Authors   map[string]Latencies `json:"authors"`
+	Reviewers map[string]Latencies `json:"reviewers"`
+	// Excluded is set by callers that filtered the pull requests with
+	// filter.Apply before building the report.
+	Excluded *filter.Excluded `json:"excluded,omitempty"`
+}
+
+// Percentile returns the p-th percentile (0 to 100) of values using linear
+// interpolation between the closest ranks.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+// NewDistribution summarizes durations in hours.
+func NewDistribution(hours []float64) Distribution {
+	return Distribution{
+		Count: len(hours),
+		P50:   Percentile(hours, 50),
+		P90:   Percentile(hours, 90),
+		P99:   Percentile(hours, 99),
+	}
+}
+
+type samples struct {
+	firstReview []float64
+	approval    []float64
+	merge       []float64
+}
+
+func (s *samples) latencies() Latencies {
+	return Latencies{
+		TimeToFirstReview: NewDistribution(s.firstReview),
+		TimeToApproval:    NewDistribution(s.approval),
+		TimeToMerge:       NewDistribution(s.merge),
+	}
+}
+
+// PeerReviewTimes returns, for everyone other than the author who reviewed
+// the pull request, when they first reviewed it and when they first approved
+// it. The approval time is zero when the reviewer never approved.
+func PeerReviewTimes(pullDetail *forge.PullDetails) (map[string]time.Time, map[string]time.Time) {
+	authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+	firstReviews := map[string]time.Time{}
+	approvals := map[string]time.Time{}
+
+	for _, review := range pullDetail.Reviews {
+		reviewerLogin := review.GetUser().GetLogin()
+		submittedAt := review.GetSubmittedAt()
+		if reviewerLogin == "" || reviewerLogin == "ghost" || strings.EqualFold(reviewerLogin, authorLogin) || submittedAt.IsZero() {
+			continue
+		}
+
+		if first, ok := firstReviews[reviewerLogin]; !ok || submittedAt.Before(first) {
+			firstReviews[reviewerLogin] = submittedAt
+		}
+		if review.GetState() != "APPROVED" {
+			continue
+		}
+		if first, ok := approvals[reviewerLogin]; !ok || submittedAt.Before(first) {
+			approvals[reviewerLogin] = submittedAt
+		}
+	}
+
+	return firstReviews, approvals
+}
+
+func earliest(times map[string]time.Time) time.Time {
+	var first time.Time
+	for _, t := range times {
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first
+}
+
+func hoursSince(start, end time.Time) float64 {
+	return end.Sub(start).Hours()
+}
+
+// Build computes the latency distributions of the pull requests.
+func Build(pullDetails []*forge.PullDetails) *Report {
+	overall := &samples{}
+	repos := map[string]*samples{}
+	authors := map[string]*samples{}
+	reviewers := map[string]*samples{}
+
+	get := func(m map[string]*samples, key string) *samples {
+		if _, ok := m[key]; !ok {
+			m[key] = &samples{}
+		}
+		return m[key]
+	}
+
+	for _, pullDetail := range pullDetails {
+		createdAt := pullDetail.PullRequest.GetCreatedAt()
+		if createdAt.IsZero() {
+			continue
+		}
+
+		groups := []*samples{overall, get(repos, pullDetail.Repo)}
+		if authorLogin := pullDetail.PullRequest.GetUser().GetLogin(); authorLogin != "" && authorLogin != "ghost" {
+			groups = append(groups, get(authors, authorLogin))
+		}
+
+		firstReviews, approvals := PeerReviewTimes(pullDetail)
+		mergedAt := pullDetail.PullRequest.GetMergedAt()
+
+		for _, s := range groups {
+			if first := earliest(firstReviews); !first.IsZero() {
+				s.firstReview = append(s.firstReview, hoursSince(createdAt, first))
+			}
+			if first := earliest(approvals); !first.IsZero() {
+				s.approval = append(s.approval, hoursSince(createdAt, first))
+			}
+			if !mergedAt.IsZero() {
+				s.merge = append(s.merge, hoursSince(createdAt, mergedAt))
+			}
+		}
+
+		for reviewerLogin, firstReview := range firstReviews {
+			s := get(reviewers, reviewerLogin)
+			s.firstReview = append(s.firstReview, hoursSince(createdAt, firstReview))
+			if approval, ok := approvals[reviewerLogin]; ok {
+				s.approval = append(s.approval, hoursSince(createdAt, approval))
+			}
+			if !mergedAt.IsZero() {
+				s.merge = append(s.merge, hoursSince(createdAt, mergedAt))
+			}
+		}
+	}
+
+	report := &Report{
+		Overall:   overall.latencies(),
+		Repos:     map[string]Latencies{},
+		Authors:   map[string]Latencies{},
+		Reviewers: map[string]Latencies{},
+	}
+	for repo, s := range repos {
+		report.Repos[repo] = s.latencies()
+	}
+	for author, s := range authors {
+		report.Authors[author] = s.latencies()
+	}
+	for reviewer, s := range reviewers {
+		report.Reviewers[reviewer] = s.latencies()
+	}
+	return report
+}
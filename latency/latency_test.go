@@ -0,0 +1,49 @@
+package latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Percentile(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0.0, Percentile(nil, 50))
+	assert.Equal(2.5, Percentile([]float64{4, 1, 3, 2}, 50))
+	assert.Equal(4.0, Percentile([]float64{4, 1, 3, 2}, 100))
+	assert.InDelta(3.7, Percentile([]float64{1, 2, 3, 4}, 90), 0.0001)
+}
+
+func Test_Build(t *testing.T) {
+	assert := assert.New(t)
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	commentedAt := createdAt.Add(2 * time.Hour)
+	approvedAt := createdAt.Add(5 * time.Hour)
+	mergedAt := createdAt.Add(6 * time.Hour)
+
+	pullDetails := []*forge.PullDetails{{
+		Repo: "foo/bar",
+		PullRequest: &forge.PullRequest{
+			User:      &forge.User{Login: github.String("alice")},
+			CreatedAt: &createdAt,
+			MergedAt:  &mergedAt,
+		},
+		Reviews: []*forge.PullRequestReview{
+			{User: &forge.User{Login: github.String("alice")}, State: github.String("COMMENTED"), SubmittedAt: &createdAt},
+			{User: &forge.User{Login: github.String("bob")}, State: github.String("COMMENTED"), SubmittedAt: &commentedAt},
+			{User: &forge.User{Login: github.String("bob")}, State: github.String("APPROVED"), SubmittedAt: &approvedAt},
+		},
+	}}
+
+	report := Build(pullDetails)
+	assert.Equal(2.0, report.Overall.TimeToFirstReview.P50)
+	assert.Equal(5.0, report.Overall.TimeToApproval.P50)
+	assert.Equal(6.0, report.Overall.TimeToMerge.P50)
+	assert.Equal(1, report.Repos["foo/bar"].TimeToMerge.Count)
+	assert.Equal(5.0, report.Authors["alice"].TimeToApproval.P90)
+	assert.Equal(2.0, report.Reviewers["bob"].TimeToFirstReview.P99)
+	assert.NotContains(report.Reviewers, "alice")
+}
@@ -2,46 +2,272 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"log"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/git"
 	"github.com/mentallyanimated/reporeportcard-core/github"
+	"github.com/mentallyanimated/reporeportcard-core/gitlab"
 	"github.com/mentallyanimated/reporeportcard-core/graph"
+	"github.com/mentallyanimated/reporeportcard-core/identity"
+	"github.com/mentallyanimated/reporeportcard-core/latency"
+	"github.com/mentallyanimated/reporeportcard-core/ownership"
+	"github.com/mentallyanimated/reporeportcard-core/pushes"
+	"github.com/mentallyanimated/reporeportcard-core/report"
 	"github.com/mentallyanimated/reporeportcard-core/server"
 	"github.com/mentallyanimated/reporeportcard-core/store"
+	"github.com/mentallyanimated/reporeportcard-core/team"
 )
 
 func main() {
 	ownerFlag := flag.String("owner", "mentallyanimated", "The owner of the repository")
 	repoFlag := flag.String("repo", "reporeportcard-core", "The repository to analyze")
+	orgFlag := flag.String("org", "", "Analyze every repository of this GitHub organization instead of a single repository")
+	reposFlag := flag.String("repos", "", "Comma separated list of owner/repo to analyze together instead of a single repository")
 	serveFlag := flag.Bool("serve", false, "Set to true to serve the API")
+	reportFlag := flag.Bool("report", false, "Set to true to print the report card instead of the graph")
+	ownershipFlag := flag.Bool("ownership", false, "Set to true to print the bus factor of every directory instead of the graph")
+	staleApprovalsFlag := flag.Bool("stale-approvals", false, "Set to true to print stale approvals per reviewer and commit to merge cycle times instead of the graph")
+	latencyFlag := flag.Bool("latency", false, "Set to true to print review latency distributions instead of the graph")
+	depthFlag := flag.Int("depth", ownership.DEFAULT_DEPTH, "The number of path components directories are grouped by for -ownership")
+	forgeFlag := flag.String("forge", "github", "The forge hosting the repository: github, gitlab or git")
+	gitlabURLFlag := flag.String("gitlab-url", gitlab.DEFAULT_BASE_URL, "The base URL of the GitLab instance")
+	gitDirFlag := flag.String("git-dir", ".", "The local clone of the single repository to read when the forge is git")
+	workersFlag := flag.Int("workers", forge.DEFAULT_WORKERS, "The number of pull requests whose details are downloaded at once")
+	gitRefFlag := flag.String("git-ref", "HEAD", "The branch to read when the forge is git")
+	groupFlag := flag.String("group", graph.GROUP_BY_RANK, "How to group nodes: rank or community")
+	metricFlag := flag.String("metric", graph.METRIC_PAGERANK, "The node metric used as the score: pagerank, betweenness, hub, authority, indegree, outdegree or reciprocity")
+	statesFlag := flag.String("states", "approved=1", "Comma separated state=weight pairs of the review states that contribute edges, e.g. approved=1,changes_requested=1.5,commented=0.5")
+	weightingFlag := flag.String("weighting", graph.WEIGHTING_COUNT, "How reviews are weighed by pull request size: count, lines or files")
+	halfLifeFlag := flag.Duration("half-life", 0, "Decay review weights by their age, halving them every half-life. The graph then covers all history instead of only -duration")
+	excludeBotsFlag := flag.Bool("exclude-bots", true, "Set to false to keep accounts of type Bot in the analysis")
+	excludeFlag := flag.String("exclude", "", "Comma separated login globs to exclude, e.g. *[bot],renovate*")
+	denyFlag := flag.String("deny", "", "Comma separated logins to exclude")
+	excludeFileFlag := flag.String("exclude-file", "", "A JSON file of exclusion rules with bots, patterns and deny fields, used instead of the other exclusion flags")
+	identitiesFlag := flag.String("identities", "", "A JSON identity mapping file collapsing the accounts of people with several of them")
+	teamsFlag := flag.String("teams", "", "A YAML or JSON file mapping team names to member logins")
+	teamsOrgFlag := flag.String("teams-org", "", "Use the teams of this GitHub organization, cached after the first fetch, instead of -teams")
+	levelFlag := flag.String("level", graph.LEVEL_PERSON, "Build the graph per person or per team")
 	durationFlag := flag.Duration("duration", 60*24*time.Hour, "The duration of the analysis")
+	formatFlag := flag.String("format", graph.FORMAT_JSON, "The graph output format: json, graphml, gexf, dot, nodes.csv or edges.csv")
+	compareFlag := flag.Bool("compare", false, "Set to true to compare the graph of the last duration against the duration before it")
 	flag.Parse()
 
-	if *ownerFlag == "" || *repoFlag == "" {
+	if *ownerFlag == "" || *repoFlag == "" || !graph.IsValidMetric(*metricFlag) || !graph.IsValidWeighting(*weightingFlag) {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if _, ok := graph.ContentType(*formatFlag); !ok {
+		flag.Usage()
+		os.Exit(1)
+	}
+	stateWeights, err := graph.ParseStateWeights(*statesFlag)
+	if err != nil {
+		log.Printf("Invalid -states: %v", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	exclude := &filter.Rules{Bots: *excludeBotsFlag}
+	if *excludeFlag != "" {
+		exclude.Patterns = strings.Split(*excludeFlag, ",")
+	}
+	if *denyFlag != "" {
+		exclude.Deny = strings.Split(*denyFlag, ",")
+	}
+	if *excludeFileFlag != "" {
+		if exclude, err = filter.LoadRules(*excludeFileFlag); err != nil {
+			log.Fatalf("Error reading %s: %v", *excludeFileFlag, err)
+		}
+	}
+
+	var identities *identity.Mapping
+	if *identitiesFlag != "" {
+		if identities, err = identity.Load(*identitiesFlag); err != nil {
+			log.Fatalf("Error reading %s: %v", *identitiesFlag, err)
+		}
+	}
+
+	var teams *team.Membership
+	if *teamsFlag != "" {
+		if teams, err = team.Load(*teamsFlag); err != nil {
+			log.Fatalf("Error reading %s: %v", *teamsFlag, err)
+		}
+	} else if *teamsOrgFlag != "" {
+		cache := store.NewDisk(*teamsOrgFlag, team.CACHE_REPO)
+		teams, err = team.ReadCache(cache)
+		if err == store.ErrNotFound {
+			orgTeams, err := github.ListOrgTeams(context.Background(), os.Getenv("GITHUB_TOKEN"), *teamsOrgFlag)
+			if err != nil {
+				log.Fatalf("Error listing teams of %s: %v", *teamsOrgFlag, err)
+			}
+			teams = team.New(orgTeams)
+			if err := team.WriteCache(cache, teams); err != nil {
+				log.Printf("Error caching teams: %v", err)
+			}
+		} else if err != nil {
+			log.Fatalf("Error reading cached teams of %s: %v", *teamsOrgFlag, err)
+		}
+	}
+	if *levelFlag == graph.LEVEL_TEAM && teams == nil && (identities == nil || len(identities.Teams()) == 0) {
+		log.Printf("-level team needs -teams, -teams-org or -identities with teams")
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	if *serveFlag {
-		server := server.NewServer()
+		server := server.NewServer(identities, teams)
 		server.Start()
 	} else {
 		owner := *ownerFlag
 		repo := *repoFlag
 
-		cache := store.NewDisk(owner, repo)
-
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		client := github.NewClient(ctx, os.Getenv("GITHUB_TOKEN"), cache, owner, repo)
-		client.DownloadPullDetails(ctx)
+		if *orgFlag != "" && *forgeFlag != "github" {
+			log.Printf("-org only lists GitHub organizations")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		repos := []string{fmt.Sprintf("%s/%s", owner, repo)}
+		if *reposFlag != "" {
+			repos = strings.Split(*reposFlag, ",")
+			owner, repo = "*", "*"
+		} else if *orgFlag != "" {
+			orgRepos, err := github.ListOrgRepositories(ctx, os.Getenv("GITHUB_TOKEN"), *orgFlag)
+			if err != nil {
+				log.Fatalf("Error listing repositories of %s: %v", *orgFlag, err)
+			}
+			repos = orgRepos
+			owner, repo = *orgFlag, "*"
+		}
+
+		// Every repository would read the same -git-dir.
+		if *forgeFlag == "git" && len(repos) > 1 {
+			log.Printf("-forge git reads a single clone and can't analyze several repositories")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		newProvider := func(cache store.Store, owner, repo string) forge.Provider {
+			switch *forgeFlag {
+			case "github":
+				return github.NewClient(ctx, os.Getenv("GITHUB_TOKEN"), cache, owner, repo)
+			case "gitlab":
+				return gitlab.NewClient(*gitlabURLFlag, os.Getenv("GITLAB_TOKEN"), owner, repo)
+			case "git":
+				return git.NewClient(*gitDirFlag, *gitRefFlag)
+			default:
+				return nil
+			}
+		}
+
+		for _, fullName := range repos {
+			repoOwner, repoName, ok := store.SplitRepo(fullName)
+			if !ok {
+				log.Fatalf("Invalid repository name %q", fullName)
+			}
+
+			cache := store.NewDisk(repoOwner, repoName)
+			provider := newProvider(cache, repoOwner, repoName)
+			if provider == nil {
+				flag.Usage()
+				os.Exit(1)
+			}
+			if err := forge.Sync(ctx, provider, cache, *workersFlag); err != nil {
+				log.Printf("Error syncing %s: %v", fullName, err)
+			}
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		graphOpts := graph.Options{Group: *groupFlag, Metric: *metricFlag, StateWeights: stateWeights, Weighting: *weightingFlag, Exclude: exclude, Identities: identities, Level: *levelFlag, Teams: teams}
+
+		now := time.Now()
+		if *compareFlag {
+			previous := graph.TimeRange{Start: now.Add(-2 * *durationFlag), End: now.Add(-*durationFlag)}
+			current := graph.TimeRange{Start: now.Add(-*durationFlag), End: now}
+			diff, err := graph.DiffGraphs(pullDetails, previous, current, graphOpts)
+			if err != nil {
+				log.Fatalf("Error comparing graphs: %v", err)
+			}
+			json.NewEncoder(os.Stdout).Encode(diff)
+			return
+		}
+
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, now.Add(-*durationFlag), now)
+
+		if *reportFlag {
+			reportPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+			if err != nil {
+				log.Fatalf("Error excluding accounts: %v", err)
+			}
+			reportCard := report.Build(owner, repo, reportPullDetails)
+			reportCard.Excluded = excluded
+			json.NewEncoder(os.Stdout).Encode(reportCard)
+			return
+		}
+
+		if *staleApprovalsFlag {
+			pushPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+			if err != nil {
+				log.Fatalf("Error excluding accounts: %v", err)
+			}
+			pushReport := pushes.Build(pushPullDetails)
+			pushReport.Excluded = excluded
+			json.NewEncoder(os.Stdout).Encode(pushReport)
+			return
+		}
+
+		if *latencyFlag {
+			latencyPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+			if err != nil {
+				log.Fatalf("Error excluding accounts: %v", err)
+			}
+			latencyReport := latency.Build(latencyPullDetails)
+			latencyReport.Excluded = excluded
+			json.NewEncoder(os.Stdout).Encode(latencyReport)
+			return
+		}
+
+		if *ownershipFlag {
+			ownershipPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+			if err != nil {
+				log.Fatalf("Error excluding accounts: %v", err)
+			}
+			result := ownership.Build(ownershipPullDetails, *depthFlag)
+			result.Excluded = excluded
+			json.NewEncoder(os.Stdout).Encode(result)
+			return
+		}
+
+		if *halfLifeFlag > 0 {
+			graphOpts.HalfLife = *halfLifeFlag
+			graphOpts.End = now
+			filteredPullDetails = graph.FilterPullDetailsByTime(pullDetails, time.Unix(0, 0), now)
+		}
 
-		pullDetails := graph.ImportRawData(owner, repo)
-		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, time.Now().Add(-*durationFlag), time.Now())
+		if *formatFlag != graph.FORMAT_JSON {
+			reviewGraph, err := graph.Build(filteredPullDetails, graphOpts)
+			if err != nil {
+				log.Fatalf("Error building graph: %v", err)
+			}
+			if err := graph.Encode(os.Stdout, reviewGraph, *formatFlag); err != nil {
+				log.Fatalf("Error writing graph: %v", err)
+			}
+			return
+		}
 
-		graph.BuildForceGraph(owner, repo, filteredPullDetails, os.Stdout)
+		if err := graph.BuildForceGraph(owner, repo, filteredPullDetails, graphOpts, os.Stdout); err != nil {
+			log.Fatalf("Error writing graph: %v", err)
+		}
 	}
 }
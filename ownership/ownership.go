@@ -0,0 +1,165 @@
+package ownership
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	DEFAULT_DEPTH = 2
+	// ROOT_PATH is used for files at the top of the repository, or for every
+	// file when the depth is 0.
+	ROOT_PATH = "."
+)
+
+// Contributor is someone who authored or approved pull requests touching a
+// path. Authoring and approving a pull request count equally towards the
+// knowledge a person has of the path.
+type Contributor struct {
+	Login    string  `json:"login"`
+	Authored int     `json:"authored"`
+	Approved int     `json:"approved"`
+	Share    float64 `json:"share"`
+}
+
+type Path struct {
+	Path         string        `json:"path"`
+	PullRequests int           `json:"pullRequests"`
+	Contributors []Contributor `json:"contributors"`
+	// BusFactor is the smallest number of people who together account for
+	// more than half of the contributions to the path.
+	BusFactor int `json:"busFactor"`
+	// Concentration is the Herfindahl-Hirschman index of contributions. A
+	// value of 1 means a single person knows the path.
+	Concentration float64 `json:"concentration"`
+}
+
+type Ownership struct {
+	Depth int    `json:"depth"`
+	Paths []Path `json:"paths"`
+	// Excluded is set by callers that filtered the pull requests with
+	// filter.Apply before building the ownership.
+	Excluded *filter.Excluded `json:"excluded,omitempty"`
+}
+
+// Directory truncates the directory of filename to at most depth components.
+func Directory(filename string, depth int) string {
+	dir := path.Dir(filename)
+	if dir == "." || depth <= 0 {
+		return ROOT_PATH
+	}
+
+	components := strings.Split(dir, "/")
+	if len(components) > depth {
+		components = components[:depth]
+	}
+	return strings.Join(components, "/")
+}
+
+// Build computes the ownership of every directory touched by the pull
+// requests, truncated to depth path components. Paths are ordered from the
+// lowest bus factor to the highest, so the riskiest paths come first.
+func Build(pullDetails []*forge.PullDetails, depth int) *Ownership {
+	type pathStats struct {
+		pullRequests int
+		contributors map[string]*Contributor
+	}
+	stats := map[string]*pathStats{}
+
+	contributor := func(s *pathStats, login string) *Contributor {
+		if _, ok := s.contributors[login]; !ok {
+			s.contributors[login] = &Contributor{Login: login}
+		}
+		return s.contributors[login]
+	}
+
+	for _, pullDetail := range pullDetails {
+		authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+
+		approvers := map[string]bool{}
+		for _, review := range pullDetail.Reviews {
+			reviewerLogin := review.GetUser().GetLogin()
+			if review.GetState() != "APPROVED" || reviewerLogin == "" || reviewerLogin == "ghost" || strings.EqualFold(reviewerLogin, authorLogin) {
+				continue
+			}
+			approvers[reviewerLogin] = true
+		}
+
+		dirs := map[string]bool{}
+		for _, file := range pullDetail.Files {
+			dirs[Directory(file.GetFilename(), depth)] = true
+		}
+
+		for dir := range dirs {
+			if _, ok := stats[dir]; !ok {
+				stats[dir] = &pathStats{contributors: map[string]*Contributor{}}
+			}
+			s := stats[dir]
+			s.pullRequests++
+
+			if authorLogin != "" && authorLogin != "ghost" {
+				contributor(s, authorLogin).Authored++
+			}
+			for approver := range approvers {
+				contributor(s, approver).Approved++
+			}
+		}
+	}
+
+	ownership := &Ownership{
+		Depth: depth,
+		Paths: []Path{},
+	}
+
+	for dir, s := range stats {
+		p := Path{
+			Path:         dir,
+			PullRequests: s.pullRequests,
+			Contributors: []Contributor{},
+		}
+
+		total := 0
+		for _, c := range s.contributors {
+			total += c.Authored + c.Approved
+		}
+		for _, c := range s.contributors {
+			c.Share = float64(c.Authored+c.Approved) / float64(total)
+			p.Contributors = append(p.Contributors, *c)
+			p.Concentration += c.Share * c.Share
+		}
+		sort.Slice(p.Contributors, func(i, j int) bool {
+			if p.Contributors[i].Share != p.Contributors[j].Share {
+				return p.Contributors[i].Share > p.Contributors[j].Share
+			}
+			return p.Contributors[i].Login < p.Contributors[j].Login
+		})
+
+		covered := 0.0
+		for _, c := range p.Contributors {
+			if covered > 0.5 {
+				break
+			}
+			covered += c.Share
+			p.BusFactor++
+		}
+
+		ownership.Paths = append(ownership.Paths, p)
+	}
+
+	sort.Slice(ownership.Paths, func(i, j int) bool {
+		a, b := ownership.Paths[i], ownership.Paths[j]
+		if a.BusFactor != b.BusFactor {
+			return a.BusFactor < b.BusFactor
+		}
+		if a.PullRequests != b.PullRequests {
+			return a.PullRequests > b.PullRequests
+		}
+		return a.Path < b.Path
+	})
+
+	return ownership
+}
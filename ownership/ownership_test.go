@@ -0,0 +1,67 @@
+package ownership
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPullDetails(author string, approvers []string, filenames ...string) *forge.PullDetails {
+	pullDetails := &forge.PullDetails{
+		PullRequest: &forge.PullRequest{User: &forge.User{Login: github.String(author)}},
+	}
+	for _, approver := range approvers {
+		pullDetails.Reviews = append(pullDetails.Reviews, &forge.PullRequestReview{
+			User:  &forge.User{Login: github.String(approver)},
+			State: github.String("APPROVED"),
+		})
+	}
+	for _, filename := range filenames {
+		pullDetails.Files = append(pullDetails.Files, &forge.CommitFile{Filename: github.String(filename)})
+	}
+	return pullDetails
+}
+
+func Test_Directory(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(ROOT_PATH, Directory("main.go", 2))
+	assert.Equal("graph", Directory("graph/pagerank.go", 2))
+	assert.Equal("web/ui", Directory("web/ui/src/App.js", 2))
+	assert.Equal(ROOT_PATH, Directory("web/ui/src/App.js", 0))
+}
+
+func Test_BusFactor(t *testing.T) {
+	assert := assert.New(t)
+	pullDetails := []*forge.PullDetails{
+		newPullDetails("alice", nil, "graph/a.go", "graph/b.go"),
+		newPullDetails("alice", nil, "graph/a.go"),
+		newPullDetails("alice", []string{"bob"}, "graph/a.go", "store/disk.go"),
+		newPullDetails("bob", []string{"carol"}, "store/disk.go"),
+	}
+
+	result := Build(pullDetails, 1)
+	assert.Len(result.Paths, 2)
+
+	graphPath := result.Paths[0]
+	assert.Equal("graph", graphPath.Path)
+	assert.Equal(3, graphPath.PullRequests)
+	assert.Equal(1, graphPath.BusFactor)
+	assert.Equal("alice", graphPath.Contributors[0].Login)
+	assert.Equal(3, graphPath.Contributors[0].Authored)
+
+	storePath := result.Paths[1]
+	assert.Equal("store", storePath.Path)
+	assert.Equal(2, storePath.BusFactor)
+	assert.Equal("bob", storePath.Contributors[0].Login)
+	assert.Equal(1, storePath.Contributors[0].Authored)
+	assert.Equal(1, storePath.Contributors[0].Approved)
+}
+
+func Test_SelfApprovalIgnoresCase(t *testing.T) {
+	result := Build([]*forge.PullDetails{newPullDetails("Alice", []string{"alice"}, "graph/a.go")}, 1)
+	assert.Len(t, result.Paths[0].Contributors, 1)
+	assert.Equal(t, 1, result.Paths[0].Contributors[0].Authored)
+	assert.Equal(t, 0, result.Paths[0].Contributors[0].Approved)
+}
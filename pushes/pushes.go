@@ -0,0 +1,126 @@
+package pushes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/latency"
+)
+
+// Reviewer summarizes how often someone's approvals went stale.
+type Reviewer struct {
+	Approvals      int `json:"approvals"`
+	StaleApprovals int `json:"staleApprovals"`
+	// StaleRate is the percentage of approvals that went stale.
+	StaleRate float64 `json:"staleRate"`
+}
+
+// Report only covers pull requests whose commits were downloaded. An approval
+// is stale when commits authored after it were pushed and the reviewer didn't
+// approve again before the merge. Rebasing or updating the branch rewrites
+// committer dates but not author dates, so it doesn't make approvals stale.
+type Report struct {
+	PullRequests   int     `json:"pullRequests"`
+	Approvals      int     `json:"approvals"`
+	StaleApprovals int     `json:"staleApprovals"`
+	StaleRate      float64 `json:"staleRate"`
+	// CycleTime is the time from the first commit being authored to the
+	// merge, in hours.
+	CycleTime latency.Distribution `json:"cycleTime"`
+	Reviewers map[string]Reviewer  `json:"reviewers"`
+	// Excluded is set by callers that filtered the pull requests with
+	// filter.Apply before building the report.
+	Excluded *filter.Excluded `json:"excluded,omitempty"`
+}
+
+// CommitTime is when the commit was authored. Unlike the committer date it
+// survives rebases, which would otherwise make every commit look like it was
+// just pushed. The committer date is used when the author date is missing.
+func CommitTime(commit *forge.RepositoryCommit) time.Time {
+	if authoredAt := commit.GetCommit().GetAuthor().GetDate(); !authoredAt.IsZero() {
+		return authoredAt
+	}
+	return commit.GetCommit().GetCommitter().GetDate()
+}
+
+// pushTimes returns the first and last commit times of the pull request.
+func pushTimes(pullDetail *forge.PullDetails) (time.Time, time.Time) {
+	var first, last time.Time
+	for _, commit := range pullDetail.Commits {
+		committedAt := CommitTime(commit)
+		if committedAt.IsZero() {
+			continue
+		}
+		if first.IsZero() || committedAt.Before(first) {
+			first = committedAt
+		}
+		if committedAt.After(last) {
+			last = committedAt
+		}
+	}
+	return first, last
+}
+
+// lastApprovals returns when each peer last approved the pull request.
+func lastApprovals(pullDetail *forge.PullDetails) map[string]time.Time {
+	authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+	approvals := map[string]time.Time{}
+	for _, review := range pullDetail.Reviews {
+		reviewerLogin := review.GetUser().GetLogin()
+		submittedAt := review.GetSubmittedAt()
+		if review.GetState() != "APPROVED" || reviewerLogin == "" || reviewerLogin == "ghost" || strings.EqualFold(reviewerLogin, authorLogin) || submittedAt.IsZero() {
+			continue
+		}
+		if submittedAt.After(approvals[reviewerLogin]) {
+			approvals[reviewerLogin] = submittedAt
+		}
+	}
+	return approvals
+}
+
+func staleRate(stale, approvals int) float64 {
+	if approvals == 0 {
+		return 0
+	}
+	return float64(stale) / float64(approvals) * 100
+}
+
+// Build finds the stale approvals and cycle times of the pull requests.
+func Build(pullDetails []*forge.PullDetails) *Report {
+	report := &Report{Reviewers: map[string]Reviewer{}}
+	cycleTimes := []float64{}
+
+	for _, pullDetail := range pullDetails {
+		firstPush, lastPush := pushTimes(pullDetail)
+		if firstPush.IsZero() {
+			continue
+		}
+		report.PullRequests++
+
+		if mergedAt := pullDetail.PullRequest.GetMergedAt(); !mergedAt.IsZero() {
+			cycleTimes = append(cycleTimes, mergedAt.Sub(firstPush).Hours())
+		}
+
+		for reviewerLogin, approvedAt := range lastApprovals(pullDetail) {
+			reviewer := report.Reviewers[reviewerLogin]
+			reviewer.Approvals++
+			report.Approvals++
+			if lastPush.After(approvedAt) {
+				reviewer.StaleApprovals++
+				report.StaleApprovals++
+			}
+			report.Reviewers[reviewerLogin] = reviewer
+		}
+	}
+
+	report.StaleRate = staleRate(report.StaleApprovals, report.Approvals)
+	for reviewerLogin, reviewer := range report.Reviewers {
+		reviewer.StaleRate = staleRate(reviewer.StaleApprovals, reviewer.Approvals)
+		report.Reviewers[reviewerLogin] = reviewer
+	}
+	report.CycleTime = latency.NewDistribution(cycleTimes)
+
+	return report
+}
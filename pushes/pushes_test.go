@@ -0,0 +1,78 @@
+package pushes
+
+import (
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCommit(authoredAt, committedAt time.Time) *forge.RepositoryCommit {
+	return &forge.RepositoryCommit{
+		Commit: &gogithub.Commit{
+			Author:    &gogithub.CommitAuthor{Date: &authoredAt},
+			Committer: &gogithub.CommitAuthor{Date: &committedAt},
+		},
+	}
+}
+
+func newApproval(reviewer string, submittedAt time.Time) *forge.PullRequestReview {
+	return &forge.PullRequestReview{
+		User:        &forge.User{Login: gogithub.String(reviewer)},
+		State:       gogithub.String("APPROVED"),
+		SubmittedAt: &submittedAt,
+	}
+}
+
+func Test_Build(t *testing.T) {
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	mergedAt := start.Add(10 * time.Hour)
+
+	pullDetails := []*forge.PullDetails{
+		{
+			PullRequest: &forge.PullRequest{User: &forge.User{Login: gogithub.String("alice")}, MergedAt: &mergedAt},
+			Reviews: []*forge.PullRequestReview{
+				// bob approved before the second push and never again.
+				newApproval("bob", start.Add(2*time.Hour)),
+				// carol approved again after the second push.
+				newApproval("carol", start.Add(2*time.Hour)),
+				newApproval("carol", start.Add(6*time.Hour)),
+			},
+			Commits: []*forge.RepositoryCommit{newCommit(start.Add(4*time.Hour), start.Add(4*time.Hour)), newCommit(start, start)},
+		},
+		{
+			// Without commits the pull request isn't covered.
+			PullRequest: &forge.PullRequest{User: &forge.User{Login: gogithub.String("alice")}, MergedAt: &mergedAt},
+			Reviews:     []*forge.PullRequestReview{newApproval("bob", start)},
+		},
+	}
+
+	report := Build(pullDetails)
+	assert.Equal(t, 1, report.PullRequests)
+	assert.Equal(t, 2, report.Approvals)
+	assert.Equal(t, 1, report.StaleApprovals)
+	assert.Equal(t, 50.0, report.StaleRate)
+	assert.Equal(t, 10.0, report.CycleTime.P50)
+	assert.Equal(t, Reviewer{Approvals: 1, StaleApprovals: 1, StaleRate: 100}, report.Reviewers["bob"])
+	assert.Equal(t, Reviewer{Approvals: 1}, report.Reviewers["carol"])
+}
+
+func Test_RebaseDoesNotMakeApprovalsStale(t *testing.T) {
+	start := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	mergedAt := start.Add(10 * time.Hour)
+	rebasedAt := start.Add(8 * time.Hour)
+
+	pullDetails := []*forge.PullDetails{{
+		PullRequest: &forge.PullRequest{User: &forge.User{Login: gogithub.String("alice")}, MergedAt: &mergedAt},
+		Reviews:     []*forge.PullRequestReview{newApproval("bob", start.Add(2*time.Hour))},
+		// Updating the branch after the approval rewrote both committer dates.
+		Commits: []*forge.RepositoryCommit{newCommit(start, rebasedAt), newCommit(start.Add(time.Hour), rebasedAt)},
+	}}
+
+	report := Build(pullDetails)
+	assert.Equal(t, 1, report.Approvals)
+	assert.Equal(t, 0, report.StaleApprovals)
+	assert.Equal(t, 10.0, report.CycleTime.P50)
+}
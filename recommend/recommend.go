@@ -0,0 +1,173 @@
+package recommend
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	DEFAULT_LIMIT = 5
+	// LOAD_WINDOW is how far back from the time of the request reviews count
+	// towards someone's current review load.
+	LOAD_WINDOW = 7 * 24 * time.Hour
+	// LOAD_PENALTY is how much each review in the load window reduces a
+	// candidate's score, relative to the score of someone with no load.
+	LOAD_PENALTY = 0.1
+)
+
+type Request struct {
+	Paths  []string `json:"paths"`
+	Author string   `json:"author"`
+	Limit  int      `json:"limit"`
+	// At is when the review is requested, which review load is measured from.
+	// It defaults to the current time.
+	At time.Time `json:"at"`
+}
+
+// Recommendation is a suggested reviewer along with the numbers the score was
+// computed from and a human readable explanation of each.
+type Recommendation struct {
+	Login string  `json:"login"`
+	Score float64 `json:"score"`
+	// PathFamiliarity sums, over every pull request the person authored or
+	// approved, how closely its files match the requested paths. Only people
+	// who reviewed at least one pull request are recommended.
+	PathFamiliarity float64 `json:"pathFamiliarity"`
+	// AuthorApprovals is how many pull requests of the requested author the
+	// person approved.
+	AuthorApprovals int `json:"authorApprovals"`
+	// ReviewLoad is how many reviews the person submitted within LOAD_WINDOW
+	// before the request.
+	ReviewLoad   int      `json:"reviewLoad"`
+	Explanations []string `json:"explanations"`
+}
+
+// similarity is the fraction of leading path components two paths share, so
+// the same file scores 1 and files in the same directory score highly.
+func similarity(a, b string) float64 {
+	aComponents := strings.Split(path.Clean(a), "/")
+	bComponents := strings.Split(path.Clean(b), "/")
+
+	shared := 0
+	for shared < len(aComponents) && shared < len(bComponents) && aComponents[shared] == bComponents[shared] {
+		shared++
+	}
+
+	longest := len(aComponents)
+	if len(bComponents) > longest {
+		longest = len(bComponents)
+	}
+	return float64(shared) / float64(longest)
+}
+
+// pathFamiliarity is how closely the pull request's files match the requested
+// paths, using the best matching file for each requested path.
+func pathFamiliarity(pullDetail *forge.PullDetails, paths []string) float64 {
+	familiarity := 0.0
+	for _, requested := range paths {
+		best := 0.0
+		for _, file := range pullDetail.Files {
+			if s := similarity(requested, file.GetFilename()); s > best {
+				best = s
+			}
+		}
+		familiarity += best
+	}
+	if len(paths) == 0 {
+		return 0
+	}
+	return familiarity / float64(len(paths))
+}
+
+func isValidLogin(login string) bool {
+	return login != "" && login != "ghost"
+}
+
+// Recommend ranks everyone who reviewed one of the pull requests as a reviewer
+// for a change touching req.Paths. The score is the path
+// familiarity plus the approvals given to the author, discounted by the
+// candidate's current review load.
+func Recommend(pullDetails []*forge.PullDetails, req Request) []Recommendation {
+	candidates := map[string]*Recommendation{}
+	candidate := func(login string) *Recommendation {
+		if _, ok := candidates[login]; !ok {
+			candidates[login] = &Recommendation{Login: login}
+		}
+		return candidates[login]
+	}
+
+	at := req.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	reviewers := map[string]bool{}
+
+	for _, pullDetail := range pullDetails {
+		familiarity := pathFamiliarity(pullDetail, req.Paths)
+		authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+		if isValidLogin(authorLogin) {
+			candidate(authorLogin).PathFamiliarity += familiarity
+		}
+
+		approvers := map[string]bool{}
+		for _, review := range pullDetail.Reviews {
+			reviewerLogin := review.GetUser().GetLogin()
+			if !isValidLogin(reviewerLogin) || strings.EqualFold(reviewerLogin, authorLogin) {
+				continue
+			}
+
+			reviewers[reviewerLogin] = true
+			c := candidate(reviewerLogin)
+			if submittedAt := review.GetSubmittedAt(); !submittedAt.After(at) && at.Sub(submittedAt) <= LOAD_WINDOW {
+				c.ReviewLoad++
+			}
+			if review.GetState() != "APPROVED" || approvers[reviewerLogin] {
+				continue
+			}
+			approvers[reviewerLogin] = true
+
+			c.PathFamiliarity += familiarity
+			if req.Author != "" && strings.EqualFold(authorLogin, req.Author) {
+				c.AuthorApprovals++
+			}
+		}
+	}
+
+	recommendations := []Recommendation{}
+	for login, c := range candidates {
+		if !reviewers[login] || strings.EqualFold(login, req.Author) || (c.PathFamiliarity == 0 && c.AuthorApprovals == 0) {
+			continue
+		}
+
+		c.Score = (c.PathFamiliarity + float64(c.AuthorApprovals)) / (1 + LOAD_PENALTY*float64(c.ReviewLoad))
+		c.Explanations = []string{
+			fmt.Sprintf("path familiarity %.2f from pull requests touching similar files", c.PathFamiliarity),
+		}
+		if req.Author != "" {
+			c.Explanations = append(c.Explanations, fmt.Sprintf("approved %d pull requests by %s", c.AuthorApprovals, req.Author))
+		}
+		c.Explanations = append(c.Explanations, fmt.Sprintf("submitted %d reviews in the last %d days", c.ReviewLoad, int(LOAD_WINDOW.Hours()/24)))
+		recommendations = append(recommendations, *c)
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].Login < recommendations[j].Login
+	})
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DEFAULT_LIMIT
+	}
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations
+}
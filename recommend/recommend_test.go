@@ -0,0 +1,98 @@
+package recommend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+
+func newPullDetails(author string, files []string, reviews ...*forge.PullRequestReview) *forge.PullDetails {
+	pullDetail := &forge.PullDetails{
+		PullRequest: &forge.PullRequest{User: &forge.User{Login: github.String(author)}},
+		Reviews:     reviews,
+	}
+	for _, file := range files {
+		pullDetail.Files = append(pullDetail.Files, &forge.CommitFile{Filename: github.String(file)})
+	}
+	return pullDetail
+}
+
+func newReview(login, state string, submittedAt time.Time) *forge.PullRequestReview {
+	return &forge.PullRequestReview{
+		User:        &forge.User{Login: github.String(login)},
+		State:       github.String(state),
+		SubmittedAt: &submittedAt,
+	}
+}
+
+func logins(recommendations []Recommendation) []string {
+	result := []string{}
+	for _, r := range recommendations {
+		result = append(result, r.Login)
+	}
+	return result
+}
+
+func Test_Similarity(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(1.0, similarity("graph/graph.go", "./graph/graph.go"))
+	assert.Equal(0.5, similarity("graph/graph.go", "graph/diff.go"))
+	assert.Equal(0.0, similarity("graph/graph.go", "store/disk.go"))
+	assert.InDelta(1.0/3, similarity("graph/graph.go", "graph/testdata/a.json"), 1e-9)
+}
+
+func Test_RecommendRanksByFamiliarity(t *testing.T) {
+	old := now.AddDate(0, 0, -30)
+	pullDetails := []*forge.PullDetails{
+		newPullDetails("alice", []string{"graph/graph.go"}, newReview("bob", "APPROVED", old), newReview("carol", "APPROVED", old)),
+		newPullDetails("alice", []string{"graph/diff.go"}, newReview("bob", "APPROVED", old)),
+		newPullDetails("dave", []string{"store/disk.go"}, newReview("carol", "APPROVED", old)),
+	}
+
+	recommendations := Recommend(pullDetails, Request{Paths: []string{"graph/graph.go"}, At: now})
+	// alice authored the most familiar changes but never reviewed, and dave's
+	// only change is unrelated.
+	assert.Equal(t, []string{"bob", "carol"}, logins(recommendations))
+	assert.Equal(t, 1.5, recommendations[0].PathFamiliarity)
+	assert.Equal(t, 1.0, recommendations[1].PathFamiliarity)
+}
+
+func Test_RecommendExcludesAuthor(t *testing.T) {
+	old := now.AddDate(0, 0, -30)
+	pullDetails := []*forge.PullDetails{
+		newPullDetails("alice", []string{"graph/graph.go"}, newReview("bob", "APPROVED", old)),
+		newPullDetails("bob", []string{"graph/graph.go"}, newReview("alice", "APPROVED", old)),
+		newPullDetails("carol", []string{"graph/graph.go"}, newReview("carol", "APPROVED", old)),
+	}
+
+	recommendations := Recommend(pullDetails, Request{Paths: []string{"graph/graph.go"}, Author: "Alice", At: now})
+	assert.Equal(t, []string{"bob"}, logins(recommendations))
+	assert.Equal(t, 1, recommendations[0].AuthorApprovals)
+}
+
+func Test_RecommendPenalizesLoad(t *testing.T) {
+	assert := assert.New(t)
+	old := now.AddDate(0, 0, -30)
+	pullDetails := []*forge.PullDetails{
+		newPullDetails("alice", []string{"graph/graph.go"}, newReview("bob", "APPROVED", old), newReview("carol", "APPROVED", old)),
+		newPullDetails("alice", []string{"store/disk.go"}, newReview("bob", "COMMENTED", now.Add(-time.Hour)), newReview("bob", "COMMENTED", now.AddDate(0, 0, -2))),
+		// Reviews after the request don't count towards the load.
+		newPullDetails("alice", []string{"store/disk.go"}, newReview("carol", "COMMENTED", now.Add(time.Hour))),
+	}
+
+	recommendations := Recommend(pullDetails, Request{Paths: []string{"graph/graph.go"}, At: now})
+	assert.Equal([]string{"carol", "bob"}, logins(recommendations))
+	assert.Equal(0, recommendations[0].ReviewLoad)
+	assert.Equal(1.0, recommendations[0].Score)
+	assert.Equal(2, recommendations[1].ReviewLoad)
+	assert.InDelta(1/(1+2*LOAD_PENALTY), recommendations[1].Score, 1e-9)
+
+	recommendations = Recommend(pullDetails, Request{Paths: []string{"graph/graph.go"}, At: now.AddDate(0, 0, 30)})
+	assert.Equal([]string{"bob", "carol"}, logins(recommendations))
+	assert.Equal(0, recommendations[0].ReviewLoad)
+}
@@ -0,0 +1,355 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/latency"
+	"github.com/mentallyanimated/reporeportcard-core/pushes"
+	"github.com/mentallyanimated/reporeportcard-core/responsiveness"
+)
+
+const (
+	METRIC_REVIEW_COVERAGE        = "reviewCoverage"
+	METRIC_SELF_MERGE_RATE        = "selfMergeRate"
+	METRIC_REVIEWER_CONCENTRATION = "reviewerConcentration"
+	METRIC_REVIEW_LATENCY         = "reviewLatency"
+	METRIC_PULL_REQUEST_SIZE      = "pullRequestSize"
+	METRIC_STALE_APPROVAL_RATE    = "staleApprovalRate"
+	METRIC_CYCLE_TIME             = "cycleTime"
+	METRIC_REVIEW_RESPONSE_RATE   = "reviewResponseRate"
+)
+
+// Metric is a single graded measurement of the repository. Score is always in
+// the range [0, 100] where higher is better, regardless of whether a high or
+// low Value is desirable for the metric.
+type Metric struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"`
+	Unit        string  `json:"unit"`
+	Score       float64 `json:"score"`
+	Grade       string  `json:"grade"`
+}
+
+type ReportCard struct {
+	Owner        string   `json:"owner"`
+	Repo         string   `json:"repo"`
+	Repos        []string `json:"repos"`
+	PullRequests int      `json:"pullRequests"`
+	Metrics      []Metric `json:"metrics"`
+	Score        float64  `json:"score"`
+	Grade        string   `json:"grade"`
+	// Excluded is set by callers that filtered the pull requests with
+	// filter.Apply before building the report card.
+	Excluded *filter.Excluded `json:"excluded,omitempty"`
+}
+
+// threshold maps an upper bound of a metric's value to the score awarded when
+// the value falls at or below it.
+type threshold struct {
+	max   float64
+	score float64
+}
+
+// scoreByThresholds is used for metrics where lower values are better. Values
+// above every threshold get the fallback score.
+func scoreByThresholds(value float64, thresholds []threshold, fallback float64) float64 {
+	for _, t := range thresholds {
+		if value <= t.max {
+			return t.score
+		}
+	}
+	return fallback
+}
+
+// Grade converts a score in the range [0, 100] into a letter grade.
+func Grade(score float64) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+func newMetric(name, description, unit string, value, score float64) Metric {
+	return Metric{
+		Name:        name,
+		Description: description,
+		Value:       value,
+		Unit:        unit,
+		Score:       score,
+		Grade:       Grade(score),
+	}
+}
+
+// Build computes the report card for the given pull requests. The pull
+// requests are expected to have been merged, as returned by
+// graph.ImportRawData or graph.ImportRepos when grading several repositories
+// together.
+func Build(owner, repo string, pullDetails []*forge.PullDetails) *ReportCard {
+	reportCard := &ReportCard{
+		Owner:        owner,
+		Repo:         repo,
+		Repos:        []string{},
+		PullRequests: len(pullDetails),
+		Metrics:      []Metric{},
+	}
+
+	seenRepos := map[string]bool{}
+	for _, pullDetail := range pullDetails {
+		if pullDetail.Repo != "" && !seenRepos[pullDetail.Repo] {
+			seenRepos[pullDetail.Repo] = true
+			reportCard.Repos = append(reportCard.Repos, pullDetail.Repo)
+		}
+	}
+	sort.Strings(reportCard.Repos)
+
+	if len(pullDetails) == 0 {
+		return reportCard
+	}
+
+	reportCard.Metrics = append(reportCard.Metrics,
+		reviewCoverage(pullDetails),
+		selfMergeRate(pullDetails),
+		reviewerConcentration(pullDetails),
+		reviewLatency(pullDetails),
+		pullRequestSize(pullDetails),
+	)
+
+	// Commits are only downloaded by some providers, and repositories synced
+	// before they were aren't graded on them.
+	if pushReport := pushes.Build(pullDetails); pushReport.PullRequests > 0 {
+		reportCard.Metrics = append(reportCard.Metrics,
+			staleApprovalRate(pushReport),
+			cycleTime(pushReport),
+		)
+	}
+
+	// Likewise for events, and repositories where reviews are never requested.
+	if responsivenessReport := responsiveness.Build(pullDetails); responsivenessReport.Requested > 0 {
+		reportCard.Metrics = append(reportCard.Metrics, reviewResponseRate(responsivenessReport))
+	}
+
+	totalScore := 0.0
+	for _, metric := range reportCard.Metrics {
+		totalScore += metric.Score
+	}
+	reportCard.Score = totalScore / float64(len(reportCard.Metrics))
+	reportCard.Grade = Grade(reportCard.Score)
+
+	return reportCard
+}
+
+// isPeerApproval reports whether the review is an approval from someone other
+// than the author of the pull request.
+func isPeerApproval(pullRequest *forge.PullRequest, review *forge.PullRequestReview) bool {
+	if review.GetState() != "APPROVED" {
+		return false
+	}
+	reviewerLogin := review.GetUser().GetLogin()
+	return reviewerLogin != "" && !strings.EqualFold(reviewerLogin, pullRequest.GetUser().GetLogin())
+}
+
+func hasPeerApproval(pullDetail *forge.PullDetails) bool {
+	for _, review := range pullDetail.Reviews {
+		if isPeerApproval(pullDetail.PullRequest, review) {
+			return true
+		}
+	}
+	return false
+}
+
+func reviewCoverage(pullDetails []*forge.PullDetails) Metric {
+	approved := 0
+	for _, pullDetail := range pullDetails {
+		if hasPeerApproval(pullDetail) {
+			approved++
+		}
+	}
+
+	coverage := float64(approved) / float64(len(pullDetails)) * 100
+	return newMetric(
+		METRIC_REVIEW_COVERAGE,
+		"Percentage of merged pull requests approved by someone other than the author",
+		"percent",
+		coverage,
+		coverage,
+	)
+}
+
+// selfMergeRate counts pull requests merged without a peer approval by their
+// author, according to the merged_by field when it was downloaded. The pull
+// request list API omits it, in which case every pull request merged without a
+// peer approval is counted as self-merged.
+func selfMergeRate(pullDetails []*forge.PullDetails) Metric {
+	selfMerged := 0
+	for _, pullDetail := range pullDetails {
+		if hasPeerApproval(pullDetail) {
+			continue
+		}
+		mergedBy := pullDetail.PullRequest.GetMergedBy().GetLogin()
+		if mergedBy == "" || strings.EqualFold(mergedBy, pullDetail.PullRequest.GetUser().GetLogin()) {
+			selfMerged++
+		}
+	}
+
+	rate := float64(selfMerged) / float64(len(pullDetails)) * 100
+	return newMetric(
+		METRIC_SELF_MERGE_RATE,
+		"Percentage of merged pull requests merged by their author without a peer approval",
+		"percent",
+		rate,
+		100-rate,
+	)
+}
+
+// reviewerConcentration is the Herfindahl-Hirschman index of peer approvals
+// across reviewers. A value of 1 means a single person approves everything.
+func reviewerConcentration(pullDetails []*forge.PullDetails) Metric {
+	approvalsByReviewer := map[string]int{}
+	totalApprovals := 0
+	for _, pullDetail := range pullDetails {
+		for _, review := range pullDetail.Reviews {
+			if !isPeerApproval(pullDetail.PullRequest, review) {
+				continue
+			}
+			approvalsByReviewer[strings.ToLower(review.GetUser().GetLogin())]++
+			totalApprovals++
+		}
+	}
+
+	if totalApprovals == 0 {
+		return newMetric(
+			METRIC_REVIEWER_CONCENTRATION,
+			"Herfindahl-Hirschman index of approvals across reviewers",
+			"index",
+			1,
+			0,
+		)
+	}
+
+	index := 0.0
+	for _, approvals := range approvalsByReviewer {
+		share := float64(approvals) / float64(totalApprovals)
+		index += share * share
+	}
+
+	return newMetric(
+		METRIC_REVIEWER_CONCENTRATION,
+		"Herfindahl-Hirschman index of approvals across reviewers",
+		"index",
+		index,
+		(1-index)*100,
+	)
+}
+
+func reviewLatency(pullDetails []*forge.PullDetails) Metric {
+	latencies := []float64{}
+	for _, pullDetail := range pullDetails {
+		createdAt := pullDetail.PullRequest.GetCreatedAt()
+		firstReviews, _ := latency.PeerReviewTimes(pullDetail)
+
+		var firstReview time.Time
+		for _, submittedAt := range firstReviews {
+			if firstReview.IsZero() || submittedAt.Before(firstReview) {
+				firstReview = submittedAt
+			}
+		}
+		if firstReview.IsZero() || createdAt.IsZero() {
+			continue
+		}
+		latencies = append(latencies, firstReview.Sub(createdAt).Hours())
+	}
+
+	if len(latencies) == 0 {
+		return newMetric(
+			METRIC_REVIEW_LATENCY,
+			"Median hours from opening a pull request to its first peer review",
+			"hours",
+			0,
+			0,
+		)
+	}
+
+	medianLatency := latency.Percentile(latencies, 50)
+	return newMetric(
+		METRIC_REVIEW_LATENCY,
+		"Median hours from opening a pull request to its first peer review",
+		"hours",
+		medianLatency,
+		scoreByThresholds(medianLatency, []threshold{
+			{max: 4, score: 100},
+			{max: 24, score: 85},
+			{max: 72, score: 75},
+			{max: 168, score: 65},
+		}, 40),
+	)
+}
+
+func pullRequestSize(pullDetails []*forge.PullDetails) Metric {
+	sizes := make([]float64, 0, len(pullDetails))
+	for _, pullDetail := range pullDetails {
+		sizes = append(sizes, float64(pullDetail.LinesChanged()))
+	}
+
+	size := latency.Percentile(sizes, 50)
+	return newMetric(
+		METRIC_PULL_REQUEST_SIZE,
+		"Median number of lines added and deleted per pull request",
+		"lines",
+		size,
+		scoreByThresholds(size, []threshold{
+			{max: 200, score: 100},
+			{max: 400, score: 85},
+			{max: 800, score: 75},
+			{max: 1600, score: 65},
+		}, 40),
+	)
+}
+
+func staleApprovalRate(pushReport *pushes.Report) Metric {
+	return newMetric(
+		METRIC_STALE_APPROVAL_RATE,
+		"Percentage of approvals followed by more commits that weren't approved again before merging",
+		"percent",
+		pushReport.StaleRate,
+		100-pushReport.StaleRate,
+	)
+}
+
+func cycleTime(pushReport *pushes.Report) Metric {
+	median := pushReport.CycleTime.P50
+	return newMetric(
+		METRIC_CYCLE_TIME,
+		"Median hours from the first commit of a pull request to its merge",
+		"hours",
+		median,
+		scoreByThresholds(median, []threshold{
+			{max: 24, score: 100},
+			{max: 72, score: 85},
+			{max: 168, score: 75},
+			{max: 336, score: 65},
+		}, 40),
+	)
+}
+
+func reviewResponseRate(responsivenessReport *responsiveness.Report) Metric {
+	return newMetric(
+		METRIC_REVIEW_RESPONSE_RATE,
+		"Percentage of review requests answered with a review",
+		"percent",
+		responsivenessReport.ResponseRate,
+		responsivenessReport.ResponseRate,
+	)
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPullDetails(author string, createdAt time.Time, reviews map[string]time.Duration, linesChanged int) *forge.PullDetails {
+	pullDetails := &forge.PullDetails{
+		PullRequest: &forge.PullRequest{
+			User:      &forge.User{Login: gogithub.String(author)},
+			CreatedAt: &createdAt,
+			Additions: gogithub.Int(linesChanged),
+			Deletions: gogithub.Int(0),
+		},
+	}
+	for reviewer, after := range reviews {
+		submittedAt := createdAt.Add(after)
+		pullDetails.Reviews = append(pullDetails.Reviews, &forge.PullRequestReview{
+			User:        &forge.User{Login: gogithub.String(reviewer)},
+			State:       gogithub.String("APPROVED"),
+			SubmittedAt: &submittedAt,
+		})
+	}
+	return pullDetails
+}
+
+func findMetric(reportCard *ReportCard, name string) Metric {
+	for _, metric := range reportCard.Metrics {
+		if metric.Name == name {
+			return metric
+		}
+	}
+	return Metric{}
+}
+
+func Test_Grade(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("A", Grade(100))
+	assert.Equal("B", Grade(85))
+	assert.Equal("C", Grade(70))
+	assert.Equal("D", Grade(65))
+	assert.Equal("F", Grade(0))
+}
+
+func Test_EmptyReportCard(t *testing.T) {
+	assert := assert.New(t)
+	reportCard := Build("foo", "bar", nil)
+	assert.Equal(0, reportCard.PullRequests)
+	assert.Empty(reportCard.Metrics)
+}
+
+func Test_BuildReportCard(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	pullDetails := []*forge.PullDetails{
+		newPullDetails("alice", now, map[string]time.Duration{"bob": time.Hour}, 100),
+		newPullDetails("bob", now, map[string]time.Duration{"alice": 3 * time.Hour}, 300),
+		newPullDetails("carol", now, map[string]time.Duration{"carol": time.Minute}, 50),
+		newPullDetails("alice", now, map[string]time.Duration{"carol": 2 * time.Hour}, 10),
+	}
+
+	reportCard := Build("foo", "bar", pullDetails)
+	assert.Equal(4, reportCard.PullRequests)
+	assert.Len(reportCard.Metrics, 5)
+
+	coverage := findMetric(reportCard, METRIC_REVIEW_COVERAGE)
+	assert.Equal(75.0, coverage.Value)
+	assert.Equal("C", coverage.Grade)
+
+	selfMerge := findMetric(reportCard, METRIC_SELF_MERGE_RATE)
+	assert.Equal(25.0, selfMerge.Value)
+
+	concentration := findMetric(reportCard, METRIC_REVIEWER_CONCENTRATION)
+	assert.InDelta(1.0/3.0, concentration.Value, 0.0001)
+
+	latency := findMetric(reportCard, METRIC_REVIEW_LATENCY)
+	assert.Equal(2.0, latency.Value)
+	assert.Equal("A", latency.Grade)
+
+	size := findMetric(reportCard, METRIC_PULL_REQUEST_SIZE)
+	assert.Equal(75.0, size.Value)
+	assert.Equal("A", size.Grade)
+}
+
+func Test_SelfMergeRateNeedsNoPeerApproval(t *testing.T) {
+	now := time.Now()
+	approved := newPullDetails("alice", now, map[string]time.Duration{"bob": time.Hour}, 10)
+	unapproved := newPullDetails("alice", now, nil, 10)
+	mergedByPeer := newPullDetails("alice", now, nil, 10)
+	for _, pullDetail := range []*forge.PullDetails{approved, unapproved} {
+		pullDetail.PullRequest.MergedBy = &forge.User{Login: gogithub.String("Alice")}
+	}
+	mergedByPeer.PullRequest.MergedBy = &forge.User{Login: gogithub.String("bob")}
+
+	reportCard := Build("foo", "bar", []*forge.PullDetails{approved, unapproved, mergedByPeer})
+	assert.InDelta(t, 100.0/3, findMetric(reportCard, METRIC_SELF_MERGE_RATE).Value, 0.0001)
+}
@@ -0,0 +1,140 @@
+package responsiveness
+
+import (
+	"strings"
+
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+)
+
+const (
+	EVENT_REVIEW_REQUESTED       = "review_requested"
+	EVENT_REVIEW_REQUEST_REMOVED = "review_request_removed"
+)
+
+// Person summarizes how someone answered the review requests they were sent.
+type Person struct {
+	// Requested counts the pull requests the person was asked to review,
+	// Responded those they reviewed and Ignored those they didn't.
+	Requested int `json:"requested"`
+	Responded int `json:"responded"`
+	Ignored   int `json:"ignored"`
+	// Unsolicited counts the pull requests the person reviewed without being
+	// asked.
+	Unsolicited int `json:"unsolicited"`
+	// ResponseRate is the percentage of requests that were answered with a
+	// review.
+	ResponseRate float64 `json:"responseRate"`
+}
+
+// Report only covers pull requests whose events were downloaded. Requests that
+// were withdrawn before the reviewer answered them aren't counted.
+type Report struct {
+	PullRequests int     `json:"pullRequests"`
+	Requested    int     `json:"requested"`
+	Responded    int     `json:"responded"`
+	Ignored      int     `json:"ignored"`
+	Unsolicited  int     `json:"unsolicited"`
+	ResponseRate float64 `json:"responseRate"`
+	// PendingTeamRequests counts the teams still asked to review when the pull
+	// requests were merged. Team requests can't be attributed to anyone.
+	PendingTeamRequests int               `json:"pendingTeamRequests"`
+	People              map[string]Person `json:"people"`
+}
+
+// requestedReviewers returns the logins asked to review the pull request. The
+// events are in the order the forge returns them, which is chronological, so
+// a request removed later is dropped unless it was requested again. Reviewers
+// still pending at merge are included even if their request event is missing.
+func requestedReviewers(pullDetail *forge.PullDetails) map[string]bool {
+	requested := map[string]bool{}
+	for _, event := range pullDetail.Events {
+		login := event.GetRequestedReviewer().GetLogin()
+		if login == "" {
+			continue
+		}
+		switch event.GetEvent() {
+		case EVENT_REVIEW_REQUESTED:
+			requested[login] = true
+		case EVENT_REVIEW_REQUEST_REMOVED:
+			delete(requested, login)
+		}
+	}
+	for _, reviewer := range pullDetail.PullRequest.RequestedReviewers {
+		if login := reviewer.GetLogin(); login != "" {
+			requested[login] = true
+		}
+	}
+	return requested
+}
+
+// reviewers returns the logins of the peers who reviewed the pull request.
+func reviewers(pullDetail *forge.PullDetails) map[string]bool {
+	authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+	reviewed := map[string]bool{}
+	for _, review := range pullDetail.Reviews {
+		reviewerLogin := review.GetUser().GetLogin()
+		if reviewerLogin == "" || reviewerLogin == "ghost" || strings.EqualFold(reviewerLogin, authorLogin) {
+			continue
+		}
+		reviewed[reviewerLogin] = true
+	}
+	return reviewed
+}
+
+func responseRate(responded, requested int) float64 {
+	if requested == 0 {
+		return 0
+	}
+	return float64(responded) / float64(requested) * 100
+}
+
+// Build compares who was asked to review each pull request with who did.
+func Build(pullDetails []*forge.PullDetails) *Report {
+	report := &Report{People: map[string]Person{}}
+
+	for _, pullDetail := range pullDetails {
+		if pullDetail.Events == nil {
+			continue
+		}
+		report.PullRequests++
+		report.PendingTeamRequests += len(pullDetail.PullRequest.RequestedTeams)
+
+		requested := requestedReviewers(pullDetail)
+		reviewed := reviewers(pullDetail)
+
+		for login := range requested {
+			if strings.EqualFold(login, pullDetail.PullRequest.GetUser().GetLogin()) {
+				continue
+			}
+			person := report.People[login]
+			person.Requested++
+			report.Requested++
+			if reviewed[login] {
+				person.Responded++
+				report.Responded++
+			} else {
+				person.Ignored++
+				report.Ignored++
+			}
+			report.People[login] = person
+		}
+
+		for login := range reviewed {
+			if requested[login] {
+				continue
+			}
+			person := report.People[login]
+			person.Unsolicited++
+			report.Unsolicited++
+			report.People[login] = person
+		}
+	}
+
+	report.ResponseRate = responseRate(report.Responded, report.Requested)
+	for login, person := range report.People {
+		person.ResponseRate = responseRate(person.Responded, person.Requested)
+		report.People[login] = person
+	}
+
+	return report
+}
@@ -0,0 +1,61 @@
+package responsiveness
+
+import (
+	"testing"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUser(login string) *forge.User {
+	return &forge.User{Login: gogithub.String(login)}
+}
+
+func newEvent(event, reviewer string) *forge.IssueEvent {
+	return &forge.IssueEvent{Event: gogithub.String(event), RequestedReviewer: newUser(reviewer)}
+}
+
+func newReview(reviewer string) *forge.PullRequestReview {
+	return &forge.PullRequestReview{User: newUser(reviewer), State: gogithub.String("COMMENTED")}
+}
+
+func Test_Build(t *testing.T) {
+	pullDetails := []*forge.PullDetails{
+		{
+			PullRequest: &forge.PullRequest{
+				User:               newUser("alice"),
+				RequestedReviewers: []*forge.User{newUser("erin")},
+				RequestedTeams:     []*gogithub.Team{{Slug: gogithub.String("platform")}},
+			},
+			Events: []*forge.IssueEvent{
+				newEvent(EVENT_REVIEW_REQUESTED, "bob"),
+				newEvent(EVENT_REVIEW_REQUESTED, "carol"),
+				// dave's request was withdrawn before being answered.
+				newEvent(EVENT_REVIEW_REQUESTED, "dave"),
+				newEvent(EVENT_REVIEW_REQUEST_REMOVED, "dave"),
+			},
+			Reviews: []*forge.PullRequestReview{newReview("bob"), newReview("frank"), newReview("alice")},
+		},
+		// Pull requests without downloaded events aren't counted.
+		{
+			PullRequest: &forge.PullRequest{User: newUser("alice")},
+			Reviews:     []*forge.PullRequestReview{newReview("frank")},
+		},
+	}
+
+	report := Build(pullDetails)
+	assert.Equal(t, 1, report.PullRequests)
+	assert.Equal(t, 3, report.Requested)
+	assert.Equal(t, 1, report.Responded)
+	assert.Equal(t, 2, report.Ignored)
+	assert.Equal(t, 1, report.Unsolicited)
+	assert.Equal(t, 1, report.PendingTeamRequests)
+	assert.InDelta(t, 100.0/3, report.ResponseRate, 1e-9)
+	assert.Equal(t, map[string]Person{
+		"bob":   {Requested: 1, Responded: 1, ResponseRate: 100},
+		"carol": {Requested: 1, Ignored: 1},
+		"erin":  {Requested: 1, Ignored: 1},
+		"frank": {Unsolicited: 1},
+	}, report.People)
+}
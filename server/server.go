@@ -2,25 +2,44 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mentallyanimated/reporeportcard-core/filter"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
 	"github.com/mentallyanimated/reporeportcard-core/graph"
+	"github.com/mentallyanimated/reporeportcard-core/identity"
+	"github.com/mentallyanimated/reporeportcard-core/latency"
+	"github.com/mentallyanimated/reporeportcard-core/ownership"
+	"github.com/mentallyanimated/reporeportcard-core/pushes"
+	"github.com/mentallyanimated/reporeportcard-core/recommend"
+	"github.com/mentallyanimated/reporeportcard-core/report"
+	"github.com/mentallyanimated/reporeportcard-core/responsiveness"
+	"github.com/mentallyanimated/reporeportcard-core/store"
+	"github.com/mentallyanimated/reporeportcard-core/team"
 	"github.com/rs/cors"
 )
 
 type Server struct {
 	httpRouter *chi.Mux
 	httpServer *http.Server
+	identities *identity.Mapping
+	teams      *team.Membership
 }
 
-func NewServer() *Server {
+// NewServer creates a server that collapses accounts with identities and
+// groups people into teams for team level graphs. Both may be nil.
+func NewServer(identities *identity.Mapping, teams *team.Membership) *Server {
 	router := chi.NewRouter()
 	httpServer := &http.Server{
 		Addr:    ":8080",
@@ -29,6 +48,8 @@ func NewServer() *Server {
 	s := &Server{
 		httpServer: httpServer,
 		httpRouter: router,
+		identities: identities,
+		teams:      teams,
 	}
 
 	s.registerRoutes()
@@ -55,32 +76,179 @@ func (s *Server) Start() {
 
 func (s *Server) registerRoutes() {
 	s.httpRouter.Get("/graph", s.graph())
+	s.httpRouter.Get("/graph/timeline", s.graphTimeline())
+	s.httpRouter.Get("/graph/diff", s.graphDiff())
+	s.httpRouter.Get("/reportcard", s.reportCard())
+	s.httpRouter.Get("/ownership", s.ownership())
+	s.httpRouter.Get("/latency", s.latency())
+	s.httpRouter.Get("/stale-approvals", s.staleApprovals())
+	s.httpRouter.Get("/people/{login}", s.person())
+	s.httpRouter.Post("/recommend-reviewers", s.recommendReviewers())
+}
+
+// requestedRepos returns the "owner/repo" names a request asks for. Either a
+// comma separated repos parameter, a single owner and repo, or only an owner to
+// analyze every repository of that owner that has been downloaded.
+func requestedRepos(r *http.Request) ([]string, error) {
+	owner := r.URL.Query().Get("owner")
+	repo := r.URL.Query().Get("repo")
+	reposParam := r.URL.Query().Get("repos")
+
+	if reposParam != "" {
+		return strings.Split(reposParam, ","), nil
+	}
+	if owner == "" {
+		return nil, errors.New("owner is required")
+	}
+	if repo == "" {
+		return store.ListRepos(owner)
+	}
+	return []string{fmt.Sprintf("%s/%s", owner, repo)}, nil
+}
+
+func requestedTimeRange(r *http.Request) (time.Time, time.Time) {
+	startParam := r.URL.Query().Get("start")
+	endParam := r.URL.Query().Get("end")
+
+	start := time.Unix(0, 0)
+	end := time.Now()
+
+	if startParam != "" {
+		start, _ = time.Parse("2006-01-02", startParam)
+	}
+	if endParam != "" {
+		end, _ = time.Parse("2006-01-02", endParam)
+	}
+	return start, end
+}
+
+// requestedExclusions reads the account exclusion rules from the query string.
+// Bots are excluded unless bots=false, exclude lists login globs and deny
+// lists logins, both comma separated.
+func requestedExclusions(r *http.Request) (*filter.Rules, error) {
+	rules := filter.DefaultRules()
+
+	if botsParam := r.URL.Query().Get("bots"); botsParam != "" {
+		bots, err := strconv.ParseBool(botsParam)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bots %q", botsParam)
+		}
+		rules.Bots = bots
+	}
+	if excludeParam := r.URL.Query().Get("exclude"); excludeParam != "" {
+		rules.Patterns = strings.Split(excludeParam, ",")
+	}
+	if denyParam := r.URL.Query().Get("deny"); denyParam != "" {
+		rules.Deny = strings.Split(denyParam, ",")
+	}
+	return rules, nil
+}
+
+// requestedGraphOptions reads the graph build options from the query string.
+// group selects between rank and community grouping, resolution tunes the
+// community detection, metric selects the node score, states and weighting
+// control edge weights, halfLife (a duration such as 720h) decays them and
+// level=team collapses people into their teams.
+func (s *Server) requestedGraphOptions(r *http.Request) (graph.Options, error) {
+	opts := graph.Options{
+		Group:      graph.GROUP_BY_RANK,
+		Metric:     graph.METRIC_PAGERANK,
+		Identities: s.identities,
+		Teams:      s.teams,
+	}
+
+	if groupParam := r.URL.Query().Get("group"); groupParam != "" {
+		if groupParam != graph.GROUP_BY_RANK && groupParam != graph.GROUP_BY_COMMUNITY {
+			return opts, fmt.Errorf("unknown group %q", groupParam)
+		}
+		opts.Group = groupParam
+	}
+
+	if metricParam := r.URL.Query().Get("metric"); metricParam != "" {
+		if !graph.IsValidMetric(metricParam) {
+			return opts, fmt.Errorf("unknown metric %q", metricParam)
+		}
+		opts.Metric = metricParam
+	}
+
+	if weightingParam := r.URL.Query().Get("weighting"); weightingParam != "" {
+		if !graph.IsValidWeighting(weightingParam) {
+			return opts, fmt.Errorf("unknown weighting %q", weightingParam)
+		}
+		opts.Weighting = weightingParam
+	}
+
+	if statesParam := r.URL.Query().Get("states"); statesParam != "" {
+		stateWeights, err := graph.ParseStateWeights(statesParam)
+		if err != nil {
+			return opts, err
+		}
+		opts.StateWeights = stateWeights
+	}
+
+	if levelParam := r.URL.Query().Get("level"); levelParam != "" {
+		if levelParam != graph.LEVEL_PERSON && levelParam != graph.LEVEL_TEAM {
+			return opts, fmt.Errorf("unknown level %q", levelParam)
+		}
+		if levelParam == graph.LEVEL_TEAM && s.teams == nil && (s.identities == nil || len(s.identities.Teams()) == 0) {
+			return opts, errors.New("no teams were configured")
+		}
+		opts.Level = levelParam
+	}
+
+	if halfLifeParam := r.URL.Query().Get("halfLife"); halfLifeParam != "" {
+		halfLife, err := time.ParseDuration(halfLifeParam)
+		if err != nil || halfLife < 0 {
+			return opts, fmt.Errorf("invalid half-life %q", halfLifeParam)
+		}
+		opts.HalfLife = halfLife
+	}
+
+	exclude, err := requestedExclusions(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Exclude = exclude
+
+	if resolutionParam := r.URL.Query().Get("resolution"); resolutionParam != "" {
+		resolution, err := strconv.ParseFloat(resolutionParam, 64)
+		if err != nil || resolution <= 0 {
+			return opts, fmt.Errorf("invalid resolution %q", resolutionParam)
+		}
+		opts.Resolution = resolution
+	}
+
+	return opts, nil
 }
 
 func (s *Server) graph() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		owner := r.URL.Query().Get("owner")
 		repo := r.URL.Query().Get("repo")
-		startParam := r.URL.Query().Get("start")
-		endParam := r.URL.Query().Get("end")
 
-		if owner == "" || repo == "" {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-
-		start := time.Unix(0, 0)
-		end := time.Now()
-
-		if startParam != "" {
-			start, _ = time.Parse("2006-01-02", startParam)
+		start, end := requestedTimeRange(r)
+		opts, err := s.requestedGraphOptions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = graph.FORMAT_JSON
 		}
-		if endParam != "" {
-			end, _ = time.Parse("2006-01-02", endParam)
+		contentType, ok := graph.ContentType(format)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
 
 		startExec := time.Now()
-		pullDetails := graph.ImportRawData(owner, repo)
+		pullDetails := graph.ImportRepos(repos)
 		log.Printf("Pulling data took %s", time.Since(startExec))
 
 		startExec = time.Now()
@@ -88,7 +256,379 @@ func (s *Server) graph() http.HandlerFunc {
 		log.Printf("Filtered pull details in %s", time.Since(startExec))
 
 		startExec = time.Now()
-		graph.BuildForceGraph(owner, repo, filteredPullDetails, w)
+		log.Printf("Building %s graph for %s/%s out of %d pull requests", format, owner, repo, len(filteredPullDetails))
+		opts.End = end
+		reviewGraph, err := graph.Build(filteredPullDetails, opts)
+		if err != nil {
+			log.Printf("Error building graph: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		log.Printf("Built graph in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", contentType)
+		if err := graph.Encode(w, reviewGraph, format); err != nil {
+			log.Printf("Error encoding graph: %v", err)
+		}
+	}
+}
+
+func (s *Server) graphTimeline() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		opts, err := s.requestedGraphOptions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		timelineOpts := graph.TimelineOptions{
+			Interval: r.URL.Query().Get("interval"),
+		}
+		for param, value := range map[string]*int{"days": &timelineOpts.Days, "step": &timelineOpts.Step} {
+			if r.URL.Query().Get(param) == "" {
+				continue
+			}
+			if *value, err = strconv.Atoi(r.URL.Query().Get(param)); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+
+		startExec := time.Now()
+		timeline, err := graph.BuildTimeline(pullDetails, start, end, opts, timelineOpts)
+		if err != nil {
+			log.Printf("Error building timeline: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Printf("Built timeline of %d windows in %s", len(timeline.Windows), time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(timeline); err != nil {
+			log.Printf("Error encoding timeline: %v", err)
+		}
+	}
+}
+
+// graphDiff compares the graph of start..end against the graph of
+// baseStart..baseEnd.
+func (s *Server) graphDiff() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		opts, err := s.requestedGraphOptions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		baseStart, err := time.Parse("2006-01-02", r.URL.Query().Get("baseStart"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		baseEnd, err := time.Parse("2006-01-02", r.URL.Query().Get("baseEnd"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+
+		startExec := time.Now()
+		diff, err := graph.DiffGraphs(
+			pullDetails,
+			graph.TimeRange{Start: baseStart, End: baseEnd},
+			graph.TimeRange{Start: start, End: end},
+			opts,
+		)
+		if err != nil {
+			log.Printf("Error building graph diff: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Printf("Built graph diff in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(diff); err != nil {
+			log.Printf("Error encoding graph diff: %v", err)
+		}
+	}
+}
+
+func (s *Server) reportCard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := r.URL.Query().Get("owner")
+		repo := r.URL.Query().Get("repo")
+
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		exclude, err := requestedExclusions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, start, end)
+		filteredPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+		if err != nil {
+			log.Printf("Error excluding accounts: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		startExec := time.Now()
+		reportCard := report.Build(owner, repo, filteredPullDetails)
+		reportCard.Excluded = excluded
+		log.Printf("Built report card in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(reportCard); err != nil {
+			log.Printf("Error encoding report card: %v", err)
+		}
+	}
+}
+
+func (s *Server) ownership() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+
+		depth := ownership.DEFAULT_DEPTH
+		if depthParam := r.URL.Query().Get("depth"); depthParam != "" {
+			depth, err = strconv.Atoi(depthParam)
+			if err != nil || depth < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		exclude, err := requestedExclusions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, start, end)
+		filteredPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+		if err != nil {
+			log.Printf("Error excluding accounts: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		startExec := time.Now()
+		result := ownership.Build(filteredPullDetails, depth)
+		result.Excluded = excluded
+		log.Printf("Built ownership in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding ownership: %v", err)
+		}
+	}
+}
+
+func (s *Server) latency() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		exclude, err := requestedExclusions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, start, end)
+		filteredPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+		if err != nil {
+			log.Printf("Error excluding accounts: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		startExec := time.Now()
+		result := latency.Build(filteredPullDetails)
+		result.Excluded = excluded
+		log.Printf("Built latency report in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding latency report: %v", err)
+		}
+	}
+}
+
+func (s *Server) staleApprovals() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		exclude, err := requestedExclusions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, start, end)
+		filteredPullDetails, excluded, err := filter.Apply(filteredPullDetails, exclude)
+		if err != nil {
+			log.Printf("Error excluding accounts: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		startExec := time.Now()
+		result := pushes.Build(filteredPullDetails)
+		result.Excluded = excluded
+		log.Printf("Built stale approvals report in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding stale approvals report: %v", err)
+		}
+	}
+}
+
+type personResponse struct {
+	Login          string                `json:"login"`
+	Responsiveness responsiveness.Person `json:"responsiveness"`
+	StaleApprovals pushes.Reviewer       `json:"staleApprovals"`
+	ReviewLatency  latency.Latencies     `json:"reviewLatency"`
+}
+
+// person reports how a single person reviews: how they answer review
+// requests, how often their approvals go stale and how quickly they review.
+func (s *Server) person() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login := chi.URLParam(r, "login")
+		repos, err := requestedRepos(r)
+		if err != nil || len(repos) == 0 || login == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		start, end := requestedTimeRange(r)
+		exclude, err := requestedExclusions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+		filteredPullDetails := graph.FilterPullDetailsByTime(pullDetails, start, end)
+		filteredPullDetails, _, err = filter.Apply(filteredPullDetails, exclude)
+		if err != nil {
+			log.Printf("Error excluding accounts: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if s.identities != nil {
+			filteredPullDetails = s.identities.Apply(filteredPullDetails)
+			if person, ok := s.identities.Lookup(&forge.User{Login: &login}); ok {
+				login = person.Login
+			}
+		}
+
+		startExec := time.Now()
+		responsivenessReport := responsiveness.Build(filteredPullDetails)
+		pushReport := pushes.Build(filteredPullDetails)
+		latencyReport := latency.Build(filteredPullDetails)
+		log.Printf("Built person report in %s", time.Since(startExec))
+
+		result := personResponse{
+			Login:          login,
+			Responsiveness: responsivenessReport.People[login],
+			StaleApprovals: pushReport.Reviewers[login],
+			ReviewLatency:  latencyReport.Reviewers[login],
+		}
+		_, requested := responsivenessReport.People[login]
+		_, approved := pushReport.Reviewers[login]
+		_, reviewed := latencyReport.Reviewers[login]
+		if !requested && !approved && !reviewed {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding person report: %v", err)
+		}
+	}
+}
+
+type recommendReviewersRequest struct {
+	Owner string   `json:"owner"`
+	Repo  string   `json:"repo"`
+	Repos []string `json:"repos"`
+	recommend.Request
+}
+
+type recommendReviewersResponse struct {
+	Recommendations []recommend.Recommendation `json:"recommendations"`
+}
+
+func (s *Server) recommendReviewers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req recommendReviewersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		repos := req.Repos
+		if len(repos) == 0 {
+			if req.Owner == "" || req.Repo == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			repos = []string{fmt.Sprintf("%s/%s", req.Owner, req.Repo)}
+		}
+		if len(req.Paths) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		pullDetails := graph.ImportRepos(repos)
+
+		startExec := time.Now()
+		recommendations := recommend.Recommend(pullDetails, req.Request)
+		log.Printf("Recommended reviewers in %s", time.Since(startExec))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(recommendReviewersResponse{
+			Recommendations: recommendations,
+		}); err != nil {
+			log.Printf("Error encoding recommendations: %v", err)
+		}
 	}
 }
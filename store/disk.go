@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"io/ioutil"
 	"strings"
 
 	"github.com/peterbourgon/diskv/v3"
@@ -63,3 +64,37 @@ func NewDisk(owner string, repo string) *Disk {
 		),
 	}
 }
+
+// ListRepos returns the "owner/repo" names of every repository under owner
+// that has been downloaded to disk. Hidden directories hold other owner level
+// data and are skipped.
+func ListRepos(owner string) ([]string, error) {
+	fileInfos, err := ioutil.ReadDir(fmt.Sprintf("%s/%s", CACHE_PREFIX, owner))
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []string{}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() && !strings.HasPrefix(fileInfo.Name(), ".") {
+			repos = append(repos, fmt.Sprintf("%s/%s", owner, fileInfo.Name()))
+		}
+	}
+	return repos, nil
+}
+
+// SplitRepo splits an "owner/repo" name. The owner may itself contain slashes
+// for nested GitLab groups, but none of its components may be empty.
+func SplitRepo(fullName string) (string, string, bool) {
+	i := strings.LastIndex(fullName, "/")
+	if i <= 0 || i == len(fullName)-1 {
+		return "", "", false
+	}
+	owner, repo := fullName[:i], fullName[i+1:]
+	for _, component := range strings.Split(owner, "/") {
+		if component == "" {
+			return "", "", false
+		}
+	}
+	return owner, repo, true
+}
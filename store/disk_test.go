@@ -2,6 +2,8 @@ package store
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,3 +32,48 @@ func Test_NotFound(t *testing.T) {
 	assert.Nil(actual)
 	assert.True(errors.Is(err, ErrNotFound))
 }
+
+func Test_SplitRepo(t *testing.T) {
+	tests := []struct {
+		fullName string
+		owner    string
+		repo     string
+		ok       bool
+	}{
+		{"foo/bar", "foo", "bar", true},
+		{"group/subgroup/bar", "group/subgroup", "bar", true},
+		{"foobar", "", "", false},
+		{"", "", "", false},
+		{"/bar", "", "", false},
+		{"foo/", "", "", false},
+		{"foo//bar", "", "", false},
+		{"/foo/bar", "", "", false},
+		{"foo/bar/", "", "", false},
+	}
+	for _, test := range tests {
+		owner, repo, ok := SplitRepo(test.fullName)
+		assert.Equal(t, test.ok, ok, test.fullName)
+		assert.Equal(t, test.owner, owner, test.fullName)
+		assert.Equal(t, test.repo, repo, test.fullName)
+	}
+}
+
+func Test_ListRepos(t *testing.T) {
+	assert := assert.New(t)
+	wd, err := os.Getwd()
+	assert.Nil(err)
+	assert.Nil(os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, repo := range []string{"bar", "baz", ".teams"} {
+		assert.Nil(NewDisk("foo", repo).Put("metadata", []byte("{}")))
+	}
+	assert.Nil(ioutil.WriteFile(CACHE_PREFIX+"/foo/notes.json", []byte("{}"), 0644))
+
+	repos, err := ListRepos("foo")
+	assert.Nil(err)
+	assert.Equal([]string{"foo/bar", "foo/baz"}, repos)
+
+	_, err = ListRepos("missing")
+	assert.Error(err)
+}
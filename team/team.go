@@ -0,0 +1,208 @@
+package team
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/mentallyanimated/reporeportcard-core/store"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// UNASSIGNED is the team of everyone who isn't a member of any team.
+	UNASSIGNED = "unassigned"
+
+	// CACHE_REPO is the directory under an owner's cache that holds the
+	// teams fetched from the forge. It starts with a dot so store.ListRepos
+	// skips it.
+	CACHE_REPO = ".teams"
+	CACHE_KEY  = "teams"
+)
+
+// Membership maps logins to the team they belong to.
+type Membership struct {
+	// Teams lists the member logins of every team.
+	Teams map[string][]string
+
+	byLogin map[string]string
+}
+
+// New indexes teams. Someone in several teams belongs to the first of them
+// in alphabetical order.
+func New(teams map[string][]string) *Membership {
+	m := &Membership{Teams: teams, byLogin: map[string]string{}}
+
+	names := make([]string, 0, len(teams))
+	for name := range teams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, login := range teams[name] {
+			key := strings.ToLower(login)
+			if _, ok := m.byLogin[key]; !ok {
+				m.byLogin[key] = name
+			}
+		}
+	}
+	return m
+}
+
+// WithFallback returns a membership that also assigns the people of teams who
+// aren't in any of m's teams, such as the teams of an identity mapping.
+func (m *Membership) WithFallback(teams map[string][]string) *Membership {
+	merged := map[string][]string{}
+	for name, logins := range m.Teams {
+		merged[name] = append([]string{}, logins...)
+	}
+	for name, logins := range teams {
+		for _, login := range logins {
+			if _, ok := m.byLogin[strings.ToLower(login)]; !ok {
+				merged[name] = append(merged[name], login)
+			}
+		}
+	}
+	return New(merged)
+}
+
+// Load reads a YAML or JSON file mapping team names to their member logins.
+func Load(filename string) (*Membership, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, so this reads both.
+	teams := map[string][]string{}
+	if err := yaml.Unmarshal(data, &teams); err != nil {
+		return nil, err
+	}
+	return New(teams), nil
+}
+
+// ReadCache reads teams written by WriteCache. It returns store.ErrNotFound
+// when nothing was cached.
+func ReadCache(cache store.Store) (*Membership, error) {
+	data, err := cache.Get(CACHE_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := map[string][]string{}
+	if err := json.Unmarshal(data, &teams); err != nil {
+		return nil, err
+	}
+	return New(teams), nil
+}
+
+// WriteCache stores the teams so they don't have to be fetched again.
+func WriteCache(cache store.Store, m *Membership) error {
+	data, err := json.Marshal(m.Teams)
+	if err != nil {
+		return err
+	}
+	return cache.Put(CACHE_KEY, data)
+}
+
+// Team returns the team of login, or UNASSIGNED.
+func (m *Membership) Team(login string) string {
+	if name, ok := m.byLogin[strings.ToLower(login)]; ok {
+		return name
+	}
+	return UNASSIGNED
+}
+
+// teamUser returns the account standing for the team of user. Deleted and
+// missing accounts are kept as is so graphs still leave them out.
+func (m *Membership) teamUser(user *forge.User) *forge.User {
+	if login := user.GetLogin(); login == "" || login == "ghost" {
+		return user
+	}
+	name := m.Team(user.GetLogin())
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return &forge.User{
+		ID:    gogithub.Int64(int64(hash.Sum64() & 0x7fffffffffffffff)),
+		Login: gogithub.String(name),
+	}
+}
+
+// Apply returns copies of the pull requests whose authors and reviewers are
+// replaced by their team, so a graph built from them has a node per team.
+func (m *Membership) Apply(pullDetails []*forge.PullDetails) []*forge.PullDetails {
+	teamPullDetails := make([]*forge.PullDetails, 0, len(pullDetails))
+	for _, pullDetail := range pullDetails {
+		pull := *pullDetail.PullRequest
+		pull.User = m.teamUser(pull.User)
+
+		reviews := make([]*forge.PullRequestReview, 0, len(pullDetail.Reviews))
+		for _, review := range pullDetail.Reviews {
+			teamReview := *review
+			teamReview.User = m.teamUser(review.User)
+			reviews = append(reviews, &teamReview)
+		}
+
+		teamPullDetail := *pullDetail
+		teamPullDetail.PullRequest = &pull
+		teamPullDetail.Reviews = reviews
+		teamPullDetails = append(teamPullDetails, &teamPullDetail)
+	}
+	return teamPullDetails
+}
+
+// Matrix counts reviews between teams. Reviews[i][j] is how many reviews of
+// pull requests authored by Teams[i] were made by members of Teams[j], so the
+// diagonal holds the reviews within each team.
+type Matrix struct {
+	Teams   []string `json:"teams"`
+	Reviews [][]int  `json:"reviews"`
+}
+
+// BuildMatrix counts the reviews between the teams of pull request authors and
+// reviewers. Only reviews whose state has a positive weight in stateWeights are
+// counted, like the edges of a graph. Self reviews and deleted accounts are
+// skipped.
+func (m *Membership) BuildMatrix(pullDetails []*forge.PullDetails, stateWeights map[string]float64) *Matrix {
+	counts := map[[2]string]int{}
+	teams := map[string]bool{}
+
+	for _, pullDetail := range pullDetails {
+		authorLogin := pullDetail.PullRequest.GetUser().GetLogin()
+		if authorLogin == "" || authorLogin == "ghost" {
+			continue
+		}
+
+		for _, review := range pullDetail.Reviews {
+			reviewerLogin := review.GetUser().GetLogin()
+			if stateWeights[review.GetState()] <= 0 || reviewerLogin == "" || reviewerLogin == "ghost" || strings.EqualFold(reviewerLogin, authorLogin) {
+				continue
+			}
+
+			authorTeam, reviewerTeam := m.Team(authorLogin), m.Team(reviewerLogin)
+			counts[[2]string{authorTeam, reviewerTeam}]++
+			teams[authorTeam] = true
+			teams[reviewerTeam] = true
+		}
+	}
+
+	matrix := &Matrix{Teams: []string{}, Reviews: [][]int{}}
+	for name := range teams {
+		matrix.Teams = append(matrix.Teams, name)
+	}
+	sort.Strings(matrix.Teams)
+
+	for _, authorTeam := range matrix.Teams {
+		row := make([]int, len(matrix.Teams))
+		for j, reviewerTeam := range matrix.Teams {
+			row[j] = counts[[2]string{authorTeam, reviewerTeam}]
+		}
+		matrix.Reviews = append(matrix.Reviews, row)
+	}
+	return matrix
+}
@@ -0,0 +1,83 @@
+package team
+
+import (
+	"testing"
+
+	gogithub "github.com/google/go-github/v41/github"
+	"github.com/mentallyanimated/reporeportcard-core/forge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPullDetails(author string, approvers ...string) *forge.PullDetails {
+	pullDetails := &forge.PullDetails{
+		PullRequest: &forge.PullRequest{User: &forge.User{Login: gogithub.String(author)}},
+	}
+	for _, approver := range approvers {
+		pullDetails.Reviews = append(pullDetails.Reviews, &forge.PullRequestReview{
+			User:  &forge.User{Login: gogithub.String(approver)},
+			State: gogithub.String("APPROVED"),
+		})
+	}
+	return pullDetails
+}
+
+func Test_BuildMatrix(t *testing.T) {
+	m := New(map[string][]string{
+		"api": {"alice", "Bob"},
+		"web": {"carol", "bob"},
+	})
+	assert.Equal(t, "api", m.Team("bob"))
+	assert.Equal(t, UNASSIGNED, m.Team("dave"))
+
+	matrix := m.BuildMatrix([]*forge.PullDetails{
+		newPullDetails("alice", "bob", "carol", "alice"),
+		newPullDetails("carol", "alice", "dave"),
+		newPullDetails("dave", "carol"),
+	}, map[string]float64{"APPROVED": 1})
+	assert.Equal(t, &Matrix{
+		Teams: []string{"api", UNASSIGNED, "web"},
+		Reviews: [][]int{
+			{1, 0, 1},
+			{0, 0, 1},
+			{1, 1, 0},
+		},
+	}, matrix)
+}
+
+func Test_Apply(t *testing.T) {
+	m := New(map[string][]string{"api": {"alice"}})
+	pullDetails := []*forge.PullDetails{newPullDetails("alice", "bob")}
+
+	teamPullDetails := m.Apply(pullDetails)
+	assert.Equal(t, "api", teamPullDetails[0].PullRequest.GetUser().GetLogin())
+	assert.Equal(t, UNASSIGNED, teamPullDetails[0].Reviews[0].GetUser().GetLogin())
+	assert.Equal(t, "alice", pullDetails[0].PullRequest.GetUser().GetLogin())
+
+	// Deleted accounts stay deleted accounts rather than joining UNASSIGNED.
+	teamPullDetails = m.Apply([]*forge.PullDetails{newPullDetails("ghost", "alice")})
+	assert.Equal(t, "ghost", teamPullDetails[0].PullRequest.GetUser().GetLogin())
+}
+
+func Test_BuildMatrixCountsWeightedStates(t *testing.T) {
+	m := New(map[string][]string{"api": {"alice"}, "web": {"bob"}})
+	pullDetails := newPullDetails("alice", "bob")
+	pullDetails.Reviews = append(pullDetails.Reviews, &forge.PullRequestReview{
+		User:  &forge.User{Login: gogithub.String("bob")},
+		State: gogithub.String("COMMENTED"),
+	})
+
+	matrix := m.BuildMatrix([]*forge.PullDetails{pullDetails}, map[string]float64{"APPROVED": 1})
+	assert.Equal(t, [][]int{{0, 1}, {0, 0}}, matrix.Reviews)
+
+	matrix = m.BuildMatrix([]*forge.PullDetails{pullDetails}, map[string]float64{"APPROVED": 1, "COMMENTED": 0.5})
+	assert.Equal(t, [][]int{{0, 2}, {0, 0}}, matrix.Reviews)
+}
+
+func Test_WithFallback(t *testing.T) {
+	m := New(map[string][]string{"api": {"alice"}}).WithFallback(map[string][]string{
+		"web": {"alice", "bob"},
+	})
+	assert.Equal(t, "api", m.Team("alice"))
+	assert.Equal(t, "web", m.Team("bob"))
+	assert.Equal(t, UNASSIGNED, m.Team("carol"))
+}